@@ -4,30 +4,168 @@ import (
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/gowool/wool"
+	"golang.org/x/text/unicode/norm"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-const basic = "basic"
+const (
+	basic   = "Basic"
+	charset = "UTF-8"
+)
 
 type Validator func(c wool.Ctx, user, password string) (bool, error)
 
 type Config struct {
-	Realm     string `mapstructure:"realm"`
+	// Realm is a protection space sent in the challenge.
+	// Optional. Default value "Restricted".
+	Realm string `mapstructure:"realm"`
+
+	// Charset advertised in the challenge, see RFC 7617 section 2.1.
+	// When set credentials are required to be valid UTF-8 and are normalized to the Unicode Normalization Form C.
+	// Optional. The only allowed value is "UTF-8".
+	Charset string `mapstructure:"charset"`
+
+	// Validator is a function to validate credentials.
+	// Required, unless PrincipalValidator, Store, Htpasswd or Routes is set.
 	Validator Validator
+
+	// PrincipalValidator is a function to validate credentials which returns the authenticated principal.
+	// It takes precedence over Validator.
+	PrincipalValidator PrincipalValidator
+
+	// Store keeps the password hashes of users, see VerifyPassword for supported formats.
+	// It is used to create the Validator when the latter is not set.
+	Store Store
+
+	// Htpasswd is a path to the htpasswd file used as Store when neither Validator nor Store is set.
+	// The file is reloaded on changes, see BasicAuth.HtpasswdFiles and BasicAuth.Close.
+	// Optional.
+	Htpasswd string `mapstructure:"htpasswd"`
+
+	// ReloadInterval defines how often the Htpasswd file is checked for changes.
+	// Optional. Default value 5s.
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+
+	// Skipper defines a function to skip the middleware.
+	// Optional.
+	Skipper Skipper
+
+	// Routes protect matching requests with their own realm and credentials, the first matching route wins.
+	// Requests matching no route are protected by the credentials of the Config,
+	// or passed through when the Config has none.
+	// Optional.
+	Routes []*Route `mapstructure:"routes"`
+
+	// Lockout enables brute-force protection which locks out usernames and client IPs
+	// after repeated failed attempts, responding with 429 Too Many Requests.
+	// Optional.
+	Lockout *LockoutConfig `mapstructure:"lockout"`
+
+	// Cache enables caching of successful verifications, so repeated requests of the same
+	// user skip the validator until the entry expires or is invalidated.
+	// The cache is cleared when a htpasswd file of Htpasswd or Store is reloaded with changes.
+	// Optional.
+	Cache *CacheConfig `mapstructure:"cache"`
+
+	challenge string
+	cache     *credentialCache
+	files     []*HtpasswdFile
 }
 
 func (cfg *Config) Init() {
-	if cfg.Validator == nil {
-		panic(errors.New("basic-auth middleware requires a validator function"))
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = defaultReloadInterval
 	}
 
 	if cfg.Realm == "" {
 		cfg.Realm = "Restricted"
-	} else {
-		cfg.Realm = strconv.Quote(cfg.Realm)
 	}
+	if cfg.Charset != "" {
+		if !strings.EqualFold(cfg.Charset, charset) {
+			panic(fmt.Errorf("basic-auth middleware supports only %s charset, got %q", charset, cfg.Charset))
+		}
+		cfg.Charset = charset
+	}
+	cfg.challenge = challenge(cfg.Realm, cfg.Charset)
+
+	cfg.PrincipalValidator = cfg.initValidator(cfg.PrincipalValidator, cfg.Validator, cfg.Store, cfg.Htpasswd)
+	if cfg.PrincipalValidator == nil && len(cfg.Routes) == 0 {
+		panic(errors.New("basic-auth middleware requires a validator function or a credential store"))
+	}
+
+	for _, route := range cfg.Routes {
+		route.init(cfg)
+	}
+
+	if cfg.Cache != nil {
+		cfg.cache = newCredentialCache(cfg.Cache)
+		if cfg.PrincipalValidator != nil {
+			cfg.PrincipalValidator = cfg.cache.wrap("", cfg.PrincipalValidator)
+		}
+		for i, route := range cfg.Routes {
+			route.PrincipalValidator = cfg.cache.wrap(strconv.Itoa(i+1), route.PrincipalValidator)
+		}
+
+		// verifications made with the previous passwords must not outlive a reload
+		for _, file := range cfg.htpasswdFiles() {
+			file.OnReload(cfg.cache.purge)
+		}
+	}
+
+	if cfg.Lockout != nil {
+		cfg.Lockout.Init()
+	}
+}
+
+// match returns the challenge and the validator protecting the request,
+// a nil validator means the request is not protected.
+func (cfg *Config) match(c wool.Ctx) (string, PrincipalValidator) {
+	for _, route := range cfg.Routes {
+		if route.match(c) {
+			return route.challenge, route.PrincipalValidator
+		}
+	}
+	return cfg.challenge, cfg.PrincipalValidator
+}
+
+// htpasswdFiles returns the files opened for Htpasswd and the HtpasswdFile stores of the Config and its Routes.
+func (cfg *Config) htpasswdFiles() []*HtpasswdFile {
+	files := append([]*HtpasswdFile(nil), cfg.files...)
+	if file, ok := cfg.Store.(*HtpasswdFile); ok {
+		files = append(files, file)
+	}
+	for _, route := range cfg.Routes {
+		if file, ok := route.Store.(*HtpasswdFile); ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (cfg *Config) initValidator(pv PrincipalValidator, v Validator, store Store, htpasswd string) PrincipalValidator {
+	if pv != nil {
+		return pv
+	}
+	if v == nil && store == nil && htpasswd != "" {
+		file, err := OpenHtpasswdFile(htpasswd, cfg.ReloadInterval)
+		if err != nil {
+			panic(fmt.Errorf("basic-auth middleware could not load htpasswd file: %w", err))
+		}
+		cfg.files = append(cfg.files, file)
+		store = file
+	}
+	if v == nil && store != nil {
+		v = StoreValidator(store)
+	}
+	if v != nil {
+		return principalValidator(v)
+	}
+	return nil
 }
 
 type BasicAuth struct {
@@ -46,7 +184,29 @@ func New(cfg *Config) *BasicAuth {
 
 func (m *BasicAuth) Middleware(next wool.Handler) wool.Handler {
 	return func(c wool.Ctx) error {
+		if m.cfg.Skipper != nil && m.cfg.Skipper(c) {
+			return next(c)
+		}
+
+		challenge, validator := m.cfg.match(c)
+		if validator == nil {
+			return next(c)
+		}
+
 		var lastError error
+
+		var ipKey string
+		if m.cfg.Lockout != nil {
+			ipKey = m.cfg.Lockout.ipKey(c)
+			until, err := m.cfg.Lockout.lockedUntil(ipKey)
+			if err != nil {
+				return err
+			}
+			if !until.IsZero() {
+				return tooManyRequests(c, until)
+			}
+		}
+
 		l := len(basic)
 		for _, auth := range c.Req().Header.Values(wool.HeaderAuthorization) {
 			if !(len(auth) > l+1 && strings.EqualFold(auth[:l], basic)) {
@@ -60,12 +220,20 @@ func (m *BasicAuth) Middleware(next wool.Handler) wool.Handler {
 				lastError = wool.NewErrBadRequest(errDecode)
 				continue
 			}
+			if m.cfg.Charset != "" {
+				if !utf8.Valid(b) {
+					lastError = wool.NewErrBadRequest(nil, "credentials are not valid UTF-8")
+					continue
+				}
+				b = norm.NFC.Bytes(b)
+			}
 			idx := bytes.IndexByte(b, ':')
 			if idx >= 0 {
-				valid, errValidate := m.cfg.Validator(c, string(b[:idx]), string(b[idx+1:]))
+				principal, errValidate := m.authenticate(c, validator, string(b[:idx]), string(b[idx+1:]), ipKey)
 				if errValidate != nil {
 					lastError = errValidate
-				} else if valid {
+				} else if principal != nil {
+					c.Set(PrincipalKey, principal)
 					return next(c)
 				}
 			}
@@ -75,7 +243,82 @@ func (m *BasicAuth) Middleware(next wool.Handler) wool.Handler {
 			return lastError
 		}
 
-		c.Res().Header().Set(wool.HeaderWWWAuthenticate, basic+" realm="+m.cfg.Realm)
+		c.Res().Header().Set(wool.HeaderWWWAuthenticate, challenge)
 		return wool.NewErrUnauthorized(nil)
 	}
 }
+
+// HtpasswdFiles returns the files opened for Htpasswd of the Config and its Routes,
+// e.g. to check Err of the last reload.
+func (m *BasicAuth) HtpasswdFiles() []*HtpasswdFile {
+	return m.cfg.files
+}
+
+// Close stops watching the files opened for Htpasswd of the Config and its Routes.
+func (m *BasicAuth) Close() error {
+	for _, file := range m.cfg.files {
+		_ = file.Close()
+	}
+	return nil
+}
+
+// Invalidate removes cached verifications of the user.
+func (m *BasicAuth) Invalidate(user string) {
+	if m.cfg.cache != nil {
+		m.cfg.cache.remove(user)
+	}
+}
+
+// InvalidateAll removes all cached verifications.
+func (m *BasicAuth) InvalidateAll() {
+	if m.cfg.cache != nil {
+		m.cfg.cache.purge()
+	}
+}
+
+func (m *BasicAuth) authenticate(c wool.Ctx, validator PrincipalValidator, user, password, ipKey string) (*Principal, error) {
+	if m.cfg.Lockout == nil {
+		return validator(c, user, password)
+	}
+
+	userKey := m.cfg.Lockout.userKey(user)
+	until, err := m.cfg.Lockout.lockedUntil(userKey)
+	if err != nil {
+		return nil, err
+	}
+	if !until.IsZero() {
+		return nil, tooManyRequests(c, until)
+	}
+
+	principal, err := validator(c, user, password)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, m.cfg.Lockout.fail(userKey, ipKey)
+	}
+	return principal, m.cfg.Lockout.reset(userKey)
+}
+
+// challenge builds the WWW-Authenticate header value, see RFC 7617 section 2.
+func challenge(realm, charset string) string {
+	if charset == "" {
+		return basic + " realm=" + quote(realm)
+	}
+	return basic + " realm=" + quote(realm) + ", charset=" + quote(charset)
+}
+
+// quote returns s as quoted-string, see RFC 9110 section 5.6.4.
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
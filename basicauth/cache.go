@@ -0,0 +1,191 @@
+package basicauth
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"github.com/gowool/wool"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	// Size is the maximum number of cached verifications, the least recently used are evicted first.
+	// Optional. Default value 1024.
+	Size int `mapstructure:"size"`
+
+	// TTL defines how long a successful verification is cached.
+	// Optional. Default value 1m.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+func (cfg *CacheConfig) Init() {
+	if cfg.Size <= 0 {
+		cfg.Size = 1024
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+}
+
+type cacheEntry struct {
+	key       string
+	sum       [sha256.Size]byte
+	principal *Principal
+	expires   time.Time
+}
+
+// credentialCache is a bounded LRU cache of successful verifications.
+// Passwords are never kept, only their salted SHA-256 sums.
+type credentialCache struct {
+	cfg    *CacheConfig
+	salt   []byte
+	mu     sync.Mutex
+	ll     *list.List
+	items  map[string]*list.Element
+	scopes []string
+	gen    uint64
+}
+
+func newCredentialCache(cfg *CacheConfig) *credentialCache {
+	cfg.Init()
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+
+	return &credentialCache{
+		cfg:   cfg,
+		salt:  salt,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// wrap returns a validator which consults the cache before calling the validator.
+// The scope separates users of different validators.
+func (cc *credentialCache) wrap(scope string, validator PrincipalValidator) PrincipalValidator {
+	cc.scopes = append(cc.scopes, scope)
+
+	return func(c wool.Ctx, user, password string) (*Principal, error) {
+		key := scope + "\x00" + user
+		sum := cc.sum(password)
+
+		principal, gen, ok := cc.get(key, sum)
+		if ok {
+			return principal, nil
+		}
+
+		principal, err := validator(c, user, password)
+		if err == nil && principal != nil {
+			cc.add(key, sum, principal, gen)
+		}
+		return principal, err
+	}
+}
+
+func (cc *credentialCache) sum(password string) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(cc.salt)
+	h.Write([]byte(password))
+
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// get returns the cached principal and the generation of the cache, which is passed to add on a miss.
+func (cc *credentialCache) get(key string, sum [sha256.Size]byte) (*Principal, uint64, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	el, ok := cc.items[key]
+	if !ok {
+		return nil, cc.gen, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cc.removeElement(el)
+		return nil, cc.gen, false
+	}
+	if subtle.ConstantTimeCompare(entry.sum[:], sum[:]) != 1 {
+		return nil, cc.gen, false
+	}
+
+	cc.ll.MoveToFront(el)
+	return entry.principal.clone(), cc.gen, true
+}
+
+// add caches the verification unless the cache was invalidated since the generation was read,
+// the verification may have used a password which is no longer valid.
+func (cc *credentialCache) add(key string, sum [sha256.Size]byte, principal *Principal, gen uint64) {
+	principal = principal.clone()
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if gen != cc.gen {
+		return
+	}
+
+	expires := time.Now().Add(cc.cfg.TTL)
+	if el, ok := cc.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.sum = sum
+		entry.principal = principal
+		entry.expires = expires
+		cc.ll.MoveToFront(el)
+		return
+	}
+
+	cc.items[key] = cc.ll.PushFront(&cacheEntry{key: key, sum: sum, principal: principal, expires: expires})
+	for cc.ll.Len() > cc.cfg.Size {
+		cc.removeElement(cc.ll.Back())
+	}
+}
+
+func (cc *credentialCache) remove(user string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.gen++
+
+	for _, scope := range cc.scopes {
+		if el, ok := cc.items[scope+"\x00"+user]; ok {
+			cc.removeElement(el)
+		}
+	}
+}
+
+func (cc *credentialCache) purge() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.gen++
+	cc.ll.Init()
+	cc.items = map[string]*list.Element{}
+}
+
+func (cc *credentialCache) removeElement(el *list.Element) {
+	cc.ll.Remove(el)
+	delete(cc.items, el.Value.(*cacheEntry).key)
+}
+
+// clone returns a copy of the principal, so requests sharing a cached principal can't modify each other's.
+// Claims values are copied shallowly.
+func (p *Principal) clone() *Principal {
+	c := &Principal{Username: p.Username}
+	if p.Roles != nil {
+		c.Roles = append([]string(nil), p.Roles...)
+	}
+	if p.Claims != nil {
+		c.Claims = make(map[string]any, len(p.Claims))
+		for k, v := range p.Claims {
+			c.Claims[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,384 @@
+package basicauth
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gowool/wool"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	digest   = "Digest"
+	qopAuth  = "auth"
+	sessPart = "-sess"
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+// DigestSecret defines a function which returns the password of the user in the realm,
+// ok is false when the user is unknown.
+type DigestSecret func(c wool.Ctx, user, realm string) (password string, ok bool, err error)
+
+type DigestConfig struct {
+	// Realm is a protection space sent in the challenge.
+	// Optional. Default value "Restricted".
+	Realm string `mapstructure:"realm"`
+
+	// Algorithms offered in the challenge in order of preference.
+	// Possible values: "SHA-256", "SHA-512-256", "MD5" and their session variants, e.g. "SHA-256-sess".
+	// Optional. Default value ["SHA-256", "MD5"].
+	Algorithms []string `mapstructure:"algorithms"`
+
+	// NonceTTL defines how long a server nonce is valid.
+	// Optional. Default value 5m.
+	NonceTTL time.Duration `mapstructure:"nonce_ttl"`
+
+	// Secret is a function which returns the password of the user.
+	// Required.
+	Secret DigestSecret
+
+	// Skipper defines a function to skip the middleware.
+	// Optional.
+	Skipper Skipper
+}
+
+func (cfg *DigestConfig) Init() {
+	if cfg.Secret == nil {
+		panic(errors.New("digest-auth middleware requires a secret function"))
+	}
+	if cfg.Realm == "" {
+		cfg.Realm = "Restricted"
+	}
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = []string{"SHA-256", "MD5"}
+	}
+	for i, algorithm := range cfg.Algorithms {
+		name, sess := splitAlgorithm(algorithm)
+		if _, ok := digestAlgorithms[name]; !ok {
+			panic(fmt.Errorf("digest-auth middleware does not support %q algorithm", algorithm))
+		}
+		if sess {
+			name += sessPart
+		}
+		cfg.Algorithms[i] = name
+	}
+	if cfg.NonceTTL <= 0 {
+		cfg.NonceTTL = 5 * time.Minute
+	}
+}
+
+// nonceSize is the size of a decoded nonce: issue time, random bytes and HMAC-SHA256 of both.
+const nonceSize = 8 + 8 + sha256.Size
+
+type digestNonce struct {
+	expires time.Time
+	nc      uint64
+}
+
+// DigestAuth implements the HTTP Digest Access Authentication, see RFC 7616.
+// Only the "auth" quality of protection is supported.
+//
+// Nonces are stateless, they carry the issue time signed with a per-instance key.
+// Only nonces of successfully authenticated requests are tracked to reject reused nonce counts.
+type DigestAuth struct {
+	cfg       *DigestConfig
+	opaque    string
+	key       []byte
+	mu        sync.Mutex
+	nonces    map[string]*digestNonce
+	lastSweep time.Time
+}
+
+func DigestMiddleware(cfg *DigestConfig) wool.Middleware {
+	return NewDigest(cfg).Middleware
+}
+
+func NewDigest(cfg *DigestConfig) *DigestAuth {
+	cfg.Init()
+
+	return &DigestAuth{
+		cfg:       cfg,
+		opaque:    randomToken(),
+		key:       randomBytes(32),
+		nonces:    map[string]*digestNonce{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *DigestAuth) Middleware(next wool.Handler) wool.Handler {
+	return func(c wool.Ctx) error {
+		if m.cfg.Skipper != nil && m.cfg.Skipper(c) {
+			return next(c)
+		}
+
+		var lastError error
+		stale := false
+		l := len(digest)
+		for _, auth := range c.Req().Header.Values(wool.HeaderAuthorization) {
+			if !(len(auth) > l+1 && strings.EqualFold(auth[:l], digest)) {
+				continue
+			}
+
+			params := parseAuthParams(auth[l+1:])
+			if params == nil {
+				lastError = wool.NewErrBadRequest(nil, "malformed digest credentials")
+				continue
+			}
+
+			principal, isStale, err := m.authenticate(c, params)
+			if err != nil {
+				lastError = err
+			} else if principal != nil {
+				c.Set(PrincipalKey, principal)
+				return next(c)
+			}
+			stale = stale || isStale
+		}
+
+		if lastError != nil {
+			return lastError
+		}
+
+		nonce := m.newNonce()
+		for _, algorithm := range m.cfg.Algorithms {
+			c.Res().Header().Add(wool.HeaderWWWAuthenticate, m.challenge(algorithm, nonce, stale))
+		}
+		return wool.NewErrUnauthorized(nil)
+	}
+}
+
+func (m *DigestAuth) authenticate(c wool.Ctx, params map[string]string) (*Principal, bool, error) {
+	user := params["username"]
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+
+	if user == "" || params["nonce"] == "" || params["response"] == "" || params["cnonce"] == "" {
+		return nil, false, wool.NewErrBadRequest(nil, "missing digest parameters")
+	}
+	if params["realm"] != m.cfg.Realm || params["opaque"] != m.opaque || !m.supports(algorithm) {
+		return nil, false, nil
+	}
+	if params["qop"] != qopAuth {
+		return nil, false, wool.NewErrBadRequest(nil, "unsupported digest qop")
+	}
+	if params["uri"] != c.Req().RequestURI {
+		return nil, false, wool.NewErrBadRequest(nil, "digest uri does not match the request")
+	}
+	nc, err := strconv.ParseUint(params["nc"], 16, 64)
+	if err != nil || len(params["nc"]) != 8 {
+		return nil, false, wool.NewErrBadRequest(nil, "malformed digest nonce count")
+	}
+
+	expires, ok := m.verifyNonce(params["nonce"])
+	if !ok {
+		return nil, false, nil
+	}
+
+	password, ok, err := m.cfg.Secret(c, user, m.cfg.Realm)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	expected := digestResponse(algorithm, user, m.cfg.Realm, password, c.Req().Method, params)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return nil, false, nil
+	}
+
+	if !m.useNonce(params["nonce"], expires, nc) {
+		return nil, true, nil
+	}
+
+	return &Principal{Username: user}, false, nil
+}
+
+func (m *DigestAuth) supports(algorithm string) bool {
+	for _, a := range m.cfg.Algorithms {
+		if strings.EqualFold(a, algorithm) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *DigestAuth) challenge(algorithm, nonce string, stale bool) string {
+	var b strings.Builder
+	b.WriteString(digest)
+	b.WriteString(" realm=")
+	b.WriteString(quote(m.cfg.Realm))
+	b.WriteString(`, qop="auth", algorithm=`)
+	b.WriteString(algorithm)
+	b.WriteString(", nonce=")
+	b.WriteString(quote(nonce))
+	b.WriteString(", opaque=")
+	b.WriteString(quote(m.opaque))
+	if stale {
+		b.WriteString(", stale=true")
+	}
+	return b.String()
+}
+
+func (m *DigestAuth) newNonce() string {
+	b := make([]byte, 16, nonceSize)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Unix()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(b, m.sign(b)...))
+}
+
+// verifyNonce reports whether the nonce was issued by the server, returning its expiration time.
+func (m *DigestAuth) verifyNonce(nonce string) (time.Time, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != nonceSize {
+		return time.Time{}, false
+	}
+	if !hmac.Equal(m.sign(b[:16]), b[16:]) {
+		return time.Time{}, false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(b)), 0)
+	return issued.Add(m.cfg.NonceTTL), true
+}
+
+func (m *DigestAuth) sign(b []byte) []byte {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// useNonce reports whether the verified nonce is not expired and the nonce count was not used before,
+// protecting against replay attacks.
+func (m *DigestAuth) useNonce(nonce string, expires time.Time, nc uint64) bool {
+	now := time.Now()
+	if now.After(expires) {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > m.cfg.NonceTTL {
+		for k, v := range m.nonces {
+			if now.After(v.expires) {
+				delete(m.nonces, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	n, ok := m.nonces[nonce]
+	if !ok {
+		n = &digestNonce{expires: expires}
+		m.nonces[nonce] = n
+	}
+	if nc <= n.nc {
+		return false
+	}
+	n.nc = nc
+	return true
+}
+
+func digestResponse(algorithm, user, realm, password, method string, params map[string]string) string {
+	name, sess := splitAlgorithm(algorithm)
+	newHash := digestAlgorithms[name]
+
+	h := func(parts ...string) string {
+		d := newHash()
+		d.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	ha1 := h(user, realm, password)
+	if sess {
+		ha1 = h(ha1, params["nonce"], params["cnonce"])
+	}
+	ha2 := h(method, params["uri"])
+
+	return h(ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+}
+
+// parseAuthParams parses a comma separated list of auth-param, see RFC 9110 section 11.2.
+// It returns nil when the list is malformed.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; {
+		idx := strings.IndexByte(s, '=')
+		if idx <= 0 {
+			return nil
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:idx]))
+		s = strings.TrimSpace(s[idx+1:])
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil
+			}
+			value = b.String()
+			s = s[i+1:]
+		} else {
+			i := strings.IndexByte(s, ',')
+			if i < 0 {
+				i = len(s)
+			}
+			value = strings.TrimSpace(s[:i])
+			s = s[i:]
+		}
+		params[key] = value
+
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if s != "" {
+			return nil
+		}
+	}
+	return params
+}
+
+// splitAlgorithm returns the upper-cased hash name of the algorithm and whether it is a session variant.
+func splitAlgorithm(algorithm string) (string, bool) {
+	name := strings.ToUpper(algorithm)
+	if strings.HasSuffix(name, "-SESS") {
+		return strings.TrimSuffix(name, "-SESS"), true
+	}
+	return name, false
+}
+
+func randomToken() string {
+	return base64.RawURLEncoding.EncodeToString(randomBytes(16))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,140 @@
+package basicauth
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultReloadInterval = 5 * time.Second
+
+// HtpasswdFile is a Store which loads users from a htpasswd file and reloads them when the file changes.
+// The user table is swapped atomically, requests in flight keep using the table they started with.
+type HtpasswdFile struct {
+	fsys    fs.FS
+	name    string
+	users   atomic.Pointer[MapStore]
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	err     error
+	hooks   []func()
+	done    chan struct{}
+	once    sync.Once
+}
+
+// OpenHtpasswdFile loads the htpasswd file at path and watches it for changes.
+func OpenHtpasswdFile(path string, interval time.Duration) (*HtpasswdFile, error) {
+	return NewHtpasswdFile(os.DirFS(filepath.Dir(path)), filepath.Base(path), interval)
+}
+
+// NewHtpasswdFile loads the htpasswd file name from fsys and polls it for changes every interval.
+// A non-positive interval disables the polling, the file may still be reloaded by calling Reload.
+func NewHtpasswdFile(fsys fs.FS, name string, interval time.Duration) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{
+		fsys: fsys,
+		name: name,
+		done: make(chan struct{}),
+	}
+
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go f.watch(interval)
+	}
+
+	return f, nil
+}
+
+func (f *HtpasswdFile) Hash(user string) (string, bool) {
+	return f.users.Load().Hash(user)
+}
+
+// Reload reads the file if it was modified since the last successful load.
+// On failure the previously loaded users are kept.
+func (f *HtpasswdFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var changed bool
+	changed, f.err = f.reload()
+	if changed {
+		for _, hook := range f.hooks {
+			hook()
+		}
+	}
+	return f.err
+}
+
+// OnReload registers a function called after a reload replaced the users,
+// e.g. to drop verifications cached with the previous passwords.
+func (f *HtpasswdFile) OnReload(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hooks = append(f.hooks, fn)
+}
+
+// Err returns the error of the last reload attempt.
+func (f *HtpasswdFile) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// Close stops watching the file.
+func (f *HtpasswdFile) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+	})
+	return nil
+}
+
+// reload reads the file and reports whether the users were replaced.
+func (f *HtpasswdFile) reload() (bool, error) {
+	info, err := fs.Stat(f.fsys, f.name)
+	if err != nil {
+		return false, err
+	}
+
+	if f.users.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	file, err := f.fsys.Open(f.name)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	users, err := ParseHtpasswd(file)
+	if err != nil {
+		return false, err
+	}
+
+	f.users.Store(&users)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	return true, nil
+}
+
+func (f *HtpasswdFile) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			_ = f.Reload()
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package basicauth
+
+import (
+	"container/list"
+	"github.com/gowool/wool"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Attempt is the state of failed authentication attempts of a single key.
+type Attempt struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// AttemptStore keeps failed authentication attempts keyed by username or client IP.
+// Implementations must be safe for concurrent use, a shared implementation allows to
+// enforce the lockout across replicas.
+type AttemptStore interface {
+	// Get returns the attempt of the key, the zero value if there is none.
+	Get(key string) (Attempt, error)
+
+	// Fail records a failed attempt of the key and returns the updated attempt.
+	// Incrementing the failures must be atomic, so concurrent failures of the key are all counted.
+	// The key is locked for the duration returned by lockout for the new number of failures, if it is positive.
+	// The attempt is kept for ttl, or until the lockout ends if it ends later.
+	Fail(key string, lockout func(failures int) time.Duration, ttl time.Duration) (Attempt, error)
+
+	// Delete removes the attempt of the key.
+	Delete(key string) error
+}
+
+type LockoutConfig struct {
+	// MaxAttempts is the number of failed attempts after which the key is locked.
+	// Optional. Default value 5.
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// BaseDelay is the lockout duration after MaxAttempts failed attempts,
+	// it is doubled on every following failed attempt.
+	// Optional. Default value 1s.
+	BaseDelay time.Duration `mapstructure:"base_delay"`
+
+	// MaxDelay caps the lockout duration.
+	// Optional. Default value 15m.
+	MaxDelay time.Duration `mapstructure:"max_delay"`
+
+	// ResetAfter defines how long failed attempts are remembered.
+	// Optional. Default value 1h.
+	ResetAfter time.Duration `mapstructure:"reset_after"`
+
+	// DisableUser turns off tracking of failed attempts by username.
+	DisableUser bool `mapstructure:"disable_user"`
+
+	// DisableIP turns off tracking of failed attempts by client IP.
+	DisableIP bool `mapstructure:"disable_ip"`
+
+	// StoreSize is the maximum number of keys kept by the default Store.
+	// Optional. Default value 10000.
+	StoreSize int `mapstructure:"store_size"`
+
+	// Store keeps failed attempts.
+	// Optional. Default value NewMemoryAttemptStore(StoreSize).
+	Store AttemptStore
+}
+
+func (cfg *LockoutConfig) Init() {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = time.Second
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = 15 * time.Minute
+	}
+	if cfg.ResetAfter <= 0 {
+		cfg.ResetAfter = time.Hour
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryAttemptStore(cfg.StoreSize)
+	}
+}
+
+func (cfg *LockoutConfig) userKey(user string) string {
+	if cfg.DisableUser {
+		return ""
+	}
+	return "user:" + user
+}
+
+func (cfg *LockoutConfig) ipKey(c wool.Ctx) string {
+	if cfg.DisableIP {
+		return ""
+	}
+	ip, _, err := net.SplitHostPort(c.Req().RemoteAddr)
+	if err != nil {
+		ip = c.Req().RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// lockedUntil returns the latest lockout deadline of the keys.
+func (cfg *LockoutConfig) lockedUntil(keys ...string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		attempt, err := cfg.Store.Get(key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if attempt.LockedUntil.After(until) {
+			until = attempt.LockedUntil
+		}
+	}
+	if until.After(time.Now()) {
+		return until, nil
+	}
+	return time.Time{}, nil
+}
+
+// fail records a failed attempt for every key, locking those that exceeded MaxAttempts.
+func (cfg *LockoutConfig) fail(keys ...string) error {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if _, err := cfg.Store.Fail(key, cfg.delay, cfg.ResetAfter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delay returns the lockout duration after the number of failures, zero below MaxAttempts.
+func (cfg *LockoutConfig) delay(failures int) time.Duration {
+	exceeded := failures - cfg.MaxAttempts
+	if exceeded < 0 {
+		return 0
+	}
+	delay := cfg.MaxDelay
+	if exceeded < 32 {
+		if d := cfg.BaseDelay << exceeded; d > 0 && d < delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+func (cfg *LockoutConfig) reset(key string) error {
+	if key == "" {
+		return nil
+	}
+	return cfg.Store.Delete(key)
+}
+
+func tooManyRequests(c wool.Ctx, until time.Time) error {
+	seconds := int(time.Until(until).Seconds() + 0.999)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Res().Header().Set(wool.HeaderRetryAfter, strconv.Itoa(seconds))
+	return wool.NewError(http.StatusTooManyRequests, nil)
+}
+
+// defaultAttemptStoreSize is the maximum number of keys of MemoryAttemptStore by default.
+const defaultAttemptStoreSize = 10000
+
+type memoryAttempt struct {
+	Attempt
+	key     string
+	expires time.Time
+}
+
+// MemoryAttemptStore is an in-memory AttemptStore.
+// It keeps a bounded number of keys, the least recently failed are evicted first,
+// so failures of random usernames can't grow it without limit.
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	size      int
+	ll        *list.List
+	items     map[string]*list.Element
+	lastSweep time.Time
+}
+
+// NewMemoryAttemptStore returns a store of at most size keys, 10000 if size is not positive.
+func NewMemoryAttemptStore(size int) *MemoryAttemptStore {
+	if size <= 0 {
+		size = defaultAttemptStoreSize
+	}
+	return &MemoryAttemptStore{
+		size:      size,
+		ll:        list.New(),
+		items:     map[string]*list.Element{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return Attempt{}, nil
+	}
+	item := el.Value.(*memoryAttempt)
+	if time.Now().After(item.expires) {
+		return Attempt{}, nil
+	}
+	return item.Attempt, nil
+}
+
+func (s *MemoryAttemptStore) Fail(key string, lockout func(failures int) time.Duration, ttl time.Duration) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	var item *memoryAttempt
+	if el, ok := s.items[key]; ok {
+		item = el.Value.(*memoryAttempt)
+		if now.After(item.expires) {
+			item.Attempt = Attempt{}
+		}
+		s.ll.MoveToFront(el)
+	} else {
+		item = &memoryAttempt{key: key}
+		s.items[key] = s.ll.PushFront(item)
+		for s.ll.Len() > s.size {
+			s.remove(s.ll.Back())
+		}
+	}
+
+	item.Failures++
+	if delay := lockout(item.Failures); delay > 0 {
+		item.LockedUntil = now.Add(delay)
+		if delay > ttl {
+			ttl = delay
+		}
+	}
+	item.expires = now.Add(ttl)
+	return item.Attempt, nil
+}
+
+func (s *MemoryAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+// sweep removes the expired keys at most once a minute.
+func (s *MemoryAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) <= time.Minute {
+		return
+	}
+	for _, el := range s.items {
+		if now.After(el.Value.(*memoryAttempt).expires) {
+			s.remove(el)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *MemoryAttemptStore) remove(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*memoryAttempt).key)
+}
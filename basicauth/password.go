@@ -0,0 +1,248 @@
+package basicauth
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"strconv"
+	"strings"
+)
+
+const (
+	prefixSHA      = "{SHA}"
+	prefixAPR1     = "$apr1$"
+	prefixArgon2id = "$argon2id$"
+	prefixScrypt   = "$scrypt$"
+
+	itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("basic-auth: unknown password hash format")
+	ErrMalformedHash     = errors.New("basic-auth: malformed password hash")
+)
+
+// VerifyPassword compares password with the stored hash in constant time.
+// The hash format is detected from the hash itself, supported formats are:
+// - bcrypt: "$2a$", "$2b$", "$2y$"
+// - argon2id in PHC string format: "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>"
+// - scrypt in PHC string format: "$scrypt$ln=15,r=8,p=1$<salt>$<hash>"
+// - Apache htpasswd SHA-1: "{SHA}<base64>"
+// - Apache htpasswd MD5: "$apr1$<salt>$<hash>"
+func VerifyPassword(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return verifyBcrypt(hash, password)
+	case strings.HasPrefix(hash, prefixArgon2id):
+		return verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, prefixScrypt):
+		return verifyScrypt(hash, password)
+	case strings.HasPrefix(hash, prefixSHA):
+		return verifySHA(hash, password)
+	case strings.HasPrefix(hash, prefixAPR1):
+		return verifyAPR1(hash, password)
+	}
+	return false, ErrUnknownHashFormat
+}
+
+func verifyBcrypt(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+}
+
+func verifyArgon2id(hash, password string) (bool, error) {
+	// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+
+	params, err := phcParams(parts[3], "m", "t", "p")
+	if err != nil || params[2] > 255 {
+		return false, ErrMalformedHash
+	}
+
+	salt, key, err := phcSaltKey(parts[4], parts[5])
+	if err != nil {
+		return false, err
+	}
+
+	derived := argon2.IDKey([]byte(password), salt, uint32(params[1]), uint32(params[0]), uint8(params[2]), uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
+
+func verifyScrypt(hash, password string) (bool, error) {
+	// $scrypt$ln=15,r=8,p=1$<salt>$<hash>
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return false, ErrMalformedHash
+	}
+
+	params, err := phcParams(parts[2], "ln", "r", "p")
+	if err != nil || params[0] > 62 {
+		return false, ErrMalformedHash
+	}
+
+	salt, key, err := phcSaltKey(parts[3], parts[4])
+	if err != nil {
+		return false, err
+	}
+
+	derived, err := scrypt.Key([]byte(password), salt, 1<<params[0], int(params[1]), int(params[2]), len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
+
+func verifySHA(hash, password string) (bool, error) {
+	key, err := base64.StdEncoding.DecodeString(hash[len(prefixSHA):])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+
+	sum := sha1.Sum([]byte(password))
+
+	return subtle.ConstantTimeCompare(sum[:], key) == 1, nil
+}
+
+func verifyAPR1(hash, password string) (bool, error) {
+	// $apr1$<salt>$<hash>
+	rest := hash[len(prefixAPR1):]
+	idx := strings.IndexByte(rest, '$')
+	if idx < 0 {
+		return false, ErrMalformedHash
+	}
+
+	derived := apr1(password, rest[:idx])
+
+	return subtle.ConstantTimeCompare([]byte(derived), []byte(hash)) == 1, nil
+}
+
+// apr1 implements the Apache variant of the MD5-based crypt algorithm.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(prefixAPR1))
+	ctx.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			ctx.Write(altSum)
+		} else {
+			ctx.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write(pw)
+		}
+		sum = round.Sum(nil)
+	}
+
+	var b strings.Builder
+	b.WriteString(prefixAPR1)
+	b.WriteString(salt)
+	b.WriteByte('$')
+
+	to64 := func(v uint, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	to64(uint(sum[0])<<16|uint(sum[6])<<8|uint(sum[12]), 4)
+	to64(uint(sum[1])<<16|uint(sum[7])<<8|uint(sum[13]), 4)
+	to64(uint(sum[2])<<16|uint(sum[8])<<8|uint(sum[14]), 4)
+	to64(uint(sum[3])<<16|uint(sum[9])<<8|uint(sum[15]), 4)
+	to64(uint(sum[4])<<16|uint(sum[10])<<8|uint(sum[5]), 4)
+	to64(uint(sum[11]), 2)
+
+	return b.String()
+}
+
+// phcParams parses a PHC parameter list like "m=65536,t=3,p=4" returning the values in the order of names.
+func phcParams(s string, names ...string) ([]uint64, error) {
+	pairs := strings.Split(s, ",")
+	if len(pairs) != len(names) {
+		return nil, ErrMalformedHash
+	}
+
+	values := make([]uint64, len(names))
+	for i, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name != names[i] {
+			return nil, ErrMalformedHash
+		}
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || v == 0 {
+			return nil, ErrMalformedHash
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func phcSaltKey(salt, key string) ([]byte, []byte, error) {
+	s, err := base64.RawStdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	k, err := base64.RawStdEncoding.DecodeString(key)
+	if err != nil || len(k) == 0 {
+		return nil, nil, ErrMalformedHash
+	}
+	return s, k, nil
+}
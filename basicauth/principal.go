@@ -0,0 +1,51 @@
+package basicauth
+
+import "github.com/gowool/wool"
+
+// PrincipalKey is the wool.Ctx key under which the authenticated Principal is stored.
+const PrincipalKey = "basicauth.principal"
+
+// Principal describes an authenticated user.
+type Principal struct {
+	Username string
+	Roles    []string
+	Claims   map[string]any
+}
+
+// HasRole reports whether the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalValidator defines a function to validate credentials which returns the authenticated principal.
+// A nil principal without error means invalid credentials.
+type PrincipalValidator func(c wool.Ctx, user, password string) (*Principal, error)
+
+// PrincipalFromCtx returns the principal authenticated by the middleware.
+func PrincipalFromCtx(c wool.Ctx) (*Principal, bool) {
+	p, ok := c.Get(PrincipalKey).(*Principal)
+	return p, ok
+}
+
+// Username returns the name of the authenticated user or an empty string.
+func Username(c wool.Ctx) string {
+	if p, ok := PrincipalFromCtx(c); ok {
+		return p.Username
+	}
+	return ""
+}
+
+func principalValidator(validator Validator) PrincipalValidator {
+	return func(c wool.Ctx, user, password string) (*Principal, error) {
+		valid, err := validator(c, user, password)
+		if err != nil || !valid {
+			return nil, err
+		}
+		return &Principal{Username: user}, nil
+	}
+}
@@ -0,0 +1,124 @@
+package basicauth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gowool/wool"
+	"net"
+	"path"
+	"strings"
+)
+
+// Skipper defines a function to skip the middleware.
+type Skipper func(c wool.Ctx) bool
+
+// Route protects the matching requests with its own realm and credentials.
+// A request matches when it matches every non-empty list of Paths, Methods and Hosts,
+// a list matches when any of its elements matches.
+type Route struct {
+	// Paths are glob patterns (see path.Match) of request paths,
+	// a pattern ending with "/**" matches the path before it and every path below it.
+	Paths []string `mapstructure:"paths"`
+
+	// Methods are HTTP methods, e.g. "GET".
+	Methods []string `mapstructure:"methods"`
+
+	// Hosts are glob patterns (see path.Match) of request hosts without the port, e.g. "*.example.com".
+	Hosts []string `mapstructure:"hosts"`
+
+	// Realm of the route.
+	// Optional. Default value is the realm of the Config.
+	Realm string `mapstructure:"realm"`
+
+	// Validator, PrincipalValidator, Store and Htpasswd define credentials of the route
+	// the same way as in Config. One of them is required.
+	Validator          Validator
+	PrincipalValidator PrincipalValidator
+	Store              Store
+	Htpasswd           string `mapstructure:"htpasswd"`
+
+	challenge string
+}
+
+func (r *Route) init(cfg *Config) {
+	for _, pattern := range append(r.Paths, r.Hosts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("basic-auth middleware route pattern %q: %w", pattern, err))
+		}
+	}
+	for i, method := range r.Methods {
+		r.Methods[i] = strings.ToUpper(method)
+	}
+	for i, host := range r.Hosts {
+		r.Hosts[i] = strings.ToLower(host)
+	}
+
+	if r.Realm == "" {
+		r.Realm = cfg.Realm
+	}
+	r.challenge = challenge(r.Realm, cfg.Charset)
+
+	r.PrincipalValidator = cfg.initValidator(r.PrincipalValidator, r.Validator, r.Store, r.Htpasswd)
+	if r.PrincipalValidator == nil {
+		panic(errors.New("basic-auth middleware route requires a validator function or a credential store"))
+	}
+}
+
+func (r *Route) match(c wool.Ctx) bool {
+	req := c.Req()
+
+	if len(r.Methods) > 0 && !contains(r.Methods, req.Method) {
+		return false
+	}
+
+	if len(r.Paths) > 0 && !matchAny(r.Paths, req.URL.Path, matchPath) {
+		return false
+	}
+
+	if len(r.Hosts) > 0 {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if !matchAny(r.Hosts, strings.ToLower(host), matchGlob) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchPath reports whether the path matches the glob pattern, a "/**" suffix also matches the subtree.
+func matchPath(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		base := strings.TrimSuffix(pattern, "/**")
+		return p == base || strings.HasPrefix(p, base+"/")
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+func matchGlob(pattern, s string) bool {
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// matchAny reports whether the value matches any of the patterns.
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether the value is one of the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package basicauth
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gowool/wool"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Store looks up the password hash of a user.
+type Store interface {
+	// Hash returns the stored password hash of the user and whether the user exists.
+	Hash(user string) (string, bool)
+}
+
+// MapStore is a Store backed by a map of user to password hash.
+type MapStore map[string]string
+
+func (s MapStore) Hash(user string) (string, bool) {
+	hash, ok := s[user]
+	return hash, ok
+}
+
+// ParseHtpasswd reads users from the Apache htpasswd format ("user:hash" per line).
+// Empty lines and lines starting with "#" are ignored.
+func ParseHtpasswd(r io.Reader) (MapStore, error) {
+	store := MapStore{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("htpasswd: malformed entry at line %d", line)
+		}
+		store[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// StoreValidator returns a Validator which verifies credentials against the hashes kept in the store.
+// The password of an unknown user is verified against the hash of the last known user, whose result is discarded,
+// so the response time doesn't reveal which users exist.
+func StoreValidator(store Store) Validator {
+	var dummy atomic.Value
+
+	return func(_ wool.Ctx, user, password string) (bool, error) {
+		hash, ok := store.Hash(user)
+		if !ok {
+			dummyHash, _ := dummy.Load().(string)
+			if dummyHash == "" {
+				dummyHash = defaultDummyHash()
+			}
+			_, _ = VerifyPassword(dummyHash, password)
+			return false, nil
+		}
+		dummy.Store(hash)
+		return VerifyPassword(hash, password)
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// defaultDummyHash returns a bcrypt hash of a random password with the default cost,
+// used for unknown users until the hash of a known user is seen.
+func defaultDummyHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword(randomBytes(32), bcrypt.DefaultCost)
+		if err != nil {
+			panic(err)
+		}
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
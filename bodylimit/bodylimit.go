@@ -1,18 +1,108 @@
 package bodylimit
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/gowool/wool"
 	"io"
+	"net/http"
 	"sync"
+	"time"
 )
 
+// LimitExceededHandler is called when the request body exceeds the limit,
+// observed is the number of bytes seen before the request was rejected, or the number of parts for MultipartConfig.MaxParts.
+type LimitExceededHandler func(c wool.Ctx, limit, observed int64)
+
 type Config struct {
-	LimitBytes int64 `mapstructure:"limit_bytes"`
+	// LimitBytes is the maximum allowed size of the request body of requests matching no rule.
+	// It is decoded from a number of bytes or a string like "10MB", see SizeDecodeHook.
+	LimitBytes Size `mapstructure:"limit_bytes"`
+
+	// Rules set different limits by path, method and content type, the first matching rule wins.
+	// Optional.
+	Rules []*Rule `mapstructure:"rules"`
+
+	// ReadTimeout is the maximum duration for reading the entire request body,
+	// the request fails with 408 Request Timeout when it is exceeded.
+	// A stalled read is interrupted by a read deadline set through http.ResponseController,
+	// which requires the wool.Response to unwrap to the http.ResponseWriter of the server.
+	// Otherwise the limits are checked between reads only, and http.Server.ReadTimeout must be set
+	// to interrupt a client that stops sending.
+	// Optional. Default value 0, no timeout.
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+
+	// MinBytesPerSecond is the minimum rate at which the client must send the request body,
+	// the request fails with 408 Request Timeout when the client is slower, see ReadTimeout for stalled reads.
+	// Optional. Default value 0, no minimum rate.
+	MinBytesPerSecond Size `mapstructure:"min_bytes_per_second"`
+
+	// MinRateGracePeriod is the time a client may spend sending the body before MinBytesPerSecond is enforced.
+	// Optional. Default value 5s.
+	MinRateGracePeriod time.Duration `mapstructure:"min_rate_grace_period"`
+
+	// Decompress enables transparent decoding of request bodies with Content-Encoding
+	// gzip, deflate, br or zstd. LimitBytes and Rules then limit the compressed size.
+	// Optional.
+	Decompress *DecompressConfig `mapstructure:"decompress"`
+
+	// Multipart enables inspection of multipart request bodies, limiting the number of parts,
+	// the size of file parts, the total size of fields and the size of part headers.
+	// Optional.
+	Multipart *MultipartConfig `mapstructure:"multipart"`
+
+	// OnLimitExceeded is called when a request is rejected for exceeding LimitBytes,
+	// the limit of the matching rule, the decompressed size limit or a multipart limit.
+	// For MaxParts the limit and the observed value are numbers of parts, for the other multipart limits bytes.
+	// Optional.
+	OnLimitExceeded LimitExceededHandler
+
+	// PrereadChunked reads request bodies of unknown length, e.g. chunked, up to the limit before calling the next handler,
+	// so an oversized body is rejected with 413 Request Entity Too Large before the handler runs.
+	// The body is buffered in memory, consider the limit before enabling it.
+	// Optional.
+	PrereadChunked bool `mapstructure:"preread_chunked"`
+
+	// Metrics enables Prometheus metrics of the observed body sizes and rejected requests.
+	// Optional.
+	Metrics *MetricsConfig `mapstructure:"metrics"`
+}
+
+func (cfg *Config) Init() {
+	if cfg.LimitBytes < 0 {
+		panic(fmt.Errorf("body-limit middleware requires a non-negative limit, got %d", cfg.LimitBytes))
+	}
+	if cfg.MinRateGracePeriod <= 0 {
+		cfg.MinRateGracePeriod = 5 * time.Second
+	}
+	for _, rule := range cfg.Rules {
+		rule.init()
+	}
+	if cfg.Decompress != nil {
+		cfg.Decompress.Init()
+	}
+	if cfg.Multipart != nil {
+		cfg.Multipart.Init()
+	}
+	if cfg.Metrics != nil {
+		cfg.Metrics.Init()
+	}
+}
+
+// limit returns the body limit of the request.
+func (cfg *Config) limit(c wool.Ctx) int64 {
+	for _, rule := range cfg.Rules {
+		if rule.match(c) {
+			return int64(rule.LimitBytes)
+		}
+	}
+	return int64(cfg.LimitBytes)
 }
 
 type BodyLimit struct {
-	cfg  *Config
-	pool sync.Pool
+	cfg     *Config
+	pool    sync.Pool
+	metrics *metrics
 }
 
 func Middleware(cfg *Config) wool.Middleware {
@@ -20,28 +110,131 @@ func Middleware(cfg *Config) wool.Middleware {
 }
 
 func New(cfg *Config) *BodyLimit {
-	return &BodyLimit{
+	cfg.Init()
+
+	m := &BodyLimit{
 		cfg: cfg,
 		pool: sync.Pool{
 			New: func() interface{} {
-				return &limitedReader{limitBytes: cfg.LimitBytes}
+				return &limitedReader{}
 			},
 		},
 	}
+	if cfg.Metrics != nil {
+		m.metrics = newMetrics(cfg.Metrics)
+	}
+	return m
 }
 
 func (m *BodyLimit) Middleware(next wool.Handler) wool.Handler {
 	return func(c wool.Ctx) error {
-		if c.Req().ContentLength > m.cfg.LimitBytes {
-			return wool.NewErrRequestEntityTooLarge(nil)
+		limit := m.cfg.limit(c)
+
+		// The declared size is checked before the body is read, so clients sending
+		// "Expect: 100-continue" are rejected without the 100 Continue response.
+		contentLength := c.Req().ContentLength
+		if contentLength > limit {
+			m.report(c, limit, contentLength, true)
+			return tooLarge(c.Res().Header())
+		}
+
+		var encodings []string
+		if m.cfg.Decompress != nil {
+			var err error
+			if encodings, err = m.cfg.Decompress.encodings(c.Req().Header); err != nil {
+				return err
+			}
+		}
+
+		body := c.Req().Body
+		if (m.cfg.ReadTimeout > 0 || m.cfg.MinBytesPerSecond > 0) && body != http.NoBody {
+			body = newTimeoutReader(body, c.Res(), m.cfg)
 		}
 
 		r := m.pool.Get().(*limitedReader)
-		r.Reset(c.Req().Body)
+		r.Reset(body, limit, c.Res().Header())
 		defer m.pool.Put(r)
 		c.Req().Body = r
 
-		return next(c)
+		if m.cfg.PrereadChunked && contentLength < 0 && body != http.NoBody {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				if r.read > r.limitBytes {
+					m.report(c, limit, r.read, true)
+				}
+				return err
+			}
+			r.Reset(&prereadBody{Reader: bytes.NewReader(b), body: body}, limit, c.Res().Header())
+		}
+
+		var dr *decompressReader
+		if len(encodings) > 0 {
+			decompressedLimit := int64(m.cfg.Decompress.LimitBytes)
+			if decompressedLimit == 0 {
+				decompressedLimit = limit
+			}
+
+			dr = &decompressReader{
+				wire:      r,
+				encodings: encodings,
+				limit:     decompressedLimit,
+				maxRatio:  m.cfg.Decompress.MaxRatio,
+				header:    c.Res().Header(),
+			}
+			c.Req().Body = dr
+			c.Req().Header.Del(wool.HeaderContentEncoding)
+			c.Req().Header.Del(wool.HeaderContentLength)
+			c.Req().ContentLength = -1
+		}
+
+		var mr *multipartReader
+		if m.cfg.Multipart != nil {
+			if boundary := m.cfg.Multipart.boundary(c.Req().Header); boundary != "" {
+				mr = newMultipartReader(c.Req().Body, boundary, m.cfg.Multipart, c.Res().Header())
+				defer mr.finish()
+				c.Req().Body = mr
+			}
+		}
+
+		err := next(c)
+
+		observed := r.read
+		if contentLength > observed {
+			observed = contentLength
+		}
+		switch {
+		case r.read > r.limitBytes:
+			m.report(c, limit, observed, true)
+		case dr != nil && dr.read > dr.limit:
+			m.report(c, dr.limit, dr.read, true)
+		case mr != nil && mr.failure() != nil:
+			m.reportMultipart(c, mr, observed)
+		default:
+			m.report(c, limit, observed, false)
+		}
+
+		return err
+	}
+}
+
+// report passes the observed body size to the hook and the metrics.
+func (m *BodyLimit) report(c wool.Ctx, limit, observed int64, exceeded bool) {
+	if exceeded && m.cfg.OnLimitExceeded != nil {
+		m.cfg.OnLimitExceeded(c, limit, observed)
+	}
+	if m.metrics != nil {
+		m.metrics.observe(c, observed, exceeded)
+	}
+}
+
+// reportMultipart passes the violated multipart limit to the hook and counts the rejected request,
+// size is the number of body bytes read.
+func (m *BodyLimit) reportMultipart(c wool.Ctx, mr *multipartReader, size int64) {
+	if m.cfg.OnLimitExceeded != nil {
+		m.cfg.OnLimitExceeded(c, mr.limit, mr.observed)
+	}
+	if m.metrics != nil {
+		m.metrics.observe(c, size, true)
 	}
 }
 
@@ -49,13 +242,21 @@ type limitedReader struct {
 	limitBytes int64
 	read       int64
 	reader     io.ReadCloser
+	header     http.Header
+	err        error
 }
 
 func (r *limitedReader) Read(b []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
 	n, err = r.reader.Read(b)
 	r.read += int64(n)
 	if r.read > r.limitBytes {
-		return n, wool.NewErrRequestEntityTooLarge(nil)
+		// withhold the data, so decoders fail with the 413 instead of a syntax error
+		r.err = tooLarge(r.header)
+		return 0, r.err
 	}
 	return
 }
@@ -64,7 +265,27 @@ func (r *limitedReader) Close() error {
 	return r.reader.Close()
 }
 
-func (r *limitedReader) Reset(reader io.ReadCloser) {
+func (r *limitedReader) Reset(reader io.ReadCloser, limitBytes int64, header http.Header) {
 	r.reader = reader
+	r.limitBytes = limitBytes
+	r.header = header
 	r.read = 0
+	r.err = nil
+}
+
+// prereadBody serves the buffered body and closes the original one.
+type prereadBody struct {
+	*bytes.Reader
+	body io.ReadCloser
+}
+
+func (b *prereadBody) Close() error {
+	return b.body.Close()
+}
+
+// tooLarge rejects the request with 413 Request Entity Too Large and closes the connection,
+// so the server doesn't read the rest of the body.
+func tooLarge(header http.Header, message ...string) error {
+	header.Set(wool.HeaderConnection, "close")
+	return wool.NewErrRequestEntityTooLarge(nil, message...)
 }
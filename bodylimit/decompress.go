@@ -0,0 +1,175 @@
+package bodylimit
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/gowool/wool"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ratioThreshold is the decompressed size after which DecompressConfig.MaxRatio is enforced,
+// small bodies may legitimately have a very high compression ratio.
+const ratioThreshold = 1 << 20
+
+var decoders = map[string]func(r io.Reader) (io.Reader, error){
+	"gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"x-gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": func(r io.Reader) (io.Reader, error) {
+		// "deflate" is the zlib format, yet some clients send a raw deflate stream.
+		br := bufio.NewReader(r)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	},
+	"br": func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	},
+	"zstd": func(r io.Reader) (io.Reader, error) {
+		// RFC 8878 section 7.2 allows HTTP decoders to limit the window size to 8MiB
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxWindow(8<<20))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+type DecompressConfig struct {
+	// Encodings are the accepted content codings, requests with other codings fail with 415 Unsupported Media Type.
+	// Possible values: "gzip", "deflate", "br", "zstd".
+	// Optional. Default value all of them.
+	Encodings []string `mapstructure:"encodings"`
+
+	// LimitBytes is the maximum allowed size of the decompressed request body.
+	// Optional. Default value is the limit of the compressed body.
+	LimitBytes Size `mapstructure:"limit_bytes"`
+
+	// MaxRatio is the maximum allowed ratio of the decompressed to the compressed size,
+	// it is enforced once more than 1MiB is decompressed.
+	// Optional. Default value 0, no limit.
+	MaxRatio float64 `mapstructure:"max_ratio"`
+}
+
+func (cfg *DecompressConfig) Init() {
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{"gzip", "deflate", "br", "zstd"}
+	}
+	for i, encoding := range cfg.Encodings {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if _, ok := decoders[encoding]; !ok {
+			panic(fmt.Errorf("body-limit middleware does not support %q content encoding", encoding))
+		}
+		cfg.Encodings[i] = encoding
+	}
+	if cfg.LimitBytes < 0 || cfg.MaxRatio < 0 {
+		panic(fmt.Errorf("body-limit middleware requires non-negative decompression limits"))
+	}
+}
+
+// encodings returns the content codings of the request in the order they were applied.
+func (cfg *DecompressConfig) encodings(header http.Header) ([]string, error) {
+	var encodings []string
+	for _, value := range header.Values(wool.HeaderContentEncoding) {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding == "" || encoding == "identity" {
+				continue
+			}
+			if !contains(cfg.Encodings, encoding) {
+				return nil, wool.NewError(http.StatusUnsupportedMediaType, nil, fmt.Sprintf("unsupported content encoding %q", encoding))
+			}
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings, nil
+}
+
+// decompressReader decodes the compressed body and limits the decompressed size and the compression ratio.
+type decompressReader struct {
+	wire      *limitedReader
+	encodings []string
+	decoder   io.Reader
+	closers   []io.Closer
+	limit     int64
+	maxRatio  float64
+	read      int64
+	header    http.Header
+	err       error
+}
+
+func (r *decompressReader) Read(b []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.decoder == nil {
+		if r.decoder, r.err = r.newDecoder(); r.err != nil {
+			return 0, r.err
+		}
+	}
+
+	n, err = r.decoder.Read(b)
+	r.read += int64(n)
+
+	if r.read > r.limit {
+		r.err = tooLarge(r.header, "decompressed request body is too large")
+		return n, r.err
+	}
+	if r.maxRatio > 0 && r.read > ratioThreshold && float64(r.read) > r.maxRatio*float64(r.wire.read) {
+		r.err = tooLarge(r.header, "request body compression ratio is too high")
+		return n, r.err
+	}
+	if err != nil && err != io.EOF {
+		err = badEncoding(err)
+	}
+	return
+}
+
+// newDecoder is called on the first read, so the body is not read before the handler asks for it.
+func (r *decompressReader) newDecoder() (io.Reader, error) {
+	var decoder io.Reader = r.wire
+	for i := len(r.encodings) - 1; i >= 0; i-- {
+		d, err := decoders[r.encodings[i]](decoder)
+		if err != nil {
+			return nil, badEncoding(err)
+		}
+		if closer, ok := d.(io.Closer); ok {
+			r.closers = append(r.closers, closer)
+		}
+		decoder = d
+	}
+	return decoder, nil
+}
+
+func (r *decompressReader) Close() error {
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		_ = r.closers[i].Close()
+	}
+	return r.wire.Close()
+}
+
+// badEncoding reports malformed compressed data as 400 Bad Request, keeping errors of the limits intact.
+func badEncoding(err error) error {
+	var e *wool.Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return wool.NewErrBadRequest(err, "malformed compressed request body")
+}
+
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
@@ -0,0 +1,83 @@
+package bodylimit
+
+import (
+	"github.com/gowool/wool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricLabels = []string{"route", "method"}
+
+type MetricsConfig struct {
+	// Namespace of the metrics.
+	// Optional. Default value "wool".
+	Namespace string `mapstructure:"namespace"`
+
+	// Buckets of the request body size histogram in bytes.
+	// Optional. Default value exponential buckets from 256B to 64MiB.
+	Buckets []float64 `mapstructure:"buckets"`
+
+	// RouteLabelMapping returns the value of the route label.
+	// Optional. Default value returns the request path.
+	RouteLabelMapping func(c wool.Ctx) string
+
+	// Registerer registers the metrics.
+	// Optional. Default value prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+func (cfg *MetricsConfig) Init() {
+	if cfg.Namespace == "" {
+		cfg.Namespace = "wool"
+	}
+	if len(cfg.Buckets) == 0 {
+		cfg.Buckets = prometheus.ExponentialBuckets(256, 4, 10)
+	}
+	if cfg.RouteLabelMapping == nil {
+		cfg.RouteLabelMapping = func(c wool.Ctx) string {
+			return c.Req().URL.Path
+		}
+	}
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.DefaultRegisterer
+	}
+}
+
+type metrics struct {
+	cfg      *MetricsConfig
+	size     *prometheus.HistogramVec
+	exceeded *prometheus.CounterVec
+}
+
+func newMetrics(cfg *MetricsConfig) *metrics {
+	m := &metrics{
+		cfg: cfg,
+		size: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: cfg.Namespace,
+				Name:      "http_request_body_size_bytes",
+				Help:      "Observed HTTP request body sizes in bytes.",
+				Buckets:   cfg.Buckets,
+			}, metricLabels,
+		),
+		exceeded: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: cfg.Namespace,
+				Name:      "http_request_body_limit_exceeded_total",
+				Help:      "Total number of HTTP requests rejected for exceeding the body limit.",
+			}, metricLabels,
+		),
+	}
+
+	cfg.Registerer.MustRegister(m.size, m.exceeded)
+
+	return m
+}
+
+func (m *metrics) observe(c wool.Ctx, observed int64, exceeded bool) {
+	lvs := []string{m.cfg.RouteLabelMapping(c), c.Req().Method}
+
+	m.size.WithLabelValues(lvs...).Observe(float64(observed))
+	if exceeded {
+		m.exceeded.WithLabelValues(lvs...).Inc()
+	}
+}
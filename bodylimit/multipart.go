@@ -0,0 +1,211 @@
+package bodylimit
+
+import (
+	"fmt"
+	"github.com/gowool/wool"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type MultipartConfig struct {
+	// MaxParts is the maximum number of parts.
+	// Optional. Default value 0, no limit.
+	MaxParts int `mapstructure:"max_parts"`
+
+	// MaxFileBytes is the maximum size of a single file part.
+	// Optional. Default value 0, no limit.
+	MaxFileBytes Size `mapstructure:"max_file_bytes"`
+
+	// MaxFieldsBytes is the maximum total size of all non-file parts.
+	// Optional. Default value 0, no limit.
+	MaxFieldsBytes Size `mapstructure:"max_fields_bytes"`
+
+	// MaxPartHeaderBytes is the maximum size of the header of a single part.
+	// Optional. Default value 0, no limit.
+	MaxPartHeaderBytes Size `mapstructure:"max_part_header_bytes"`
+}
+
+func (cfg *MultipartConfig) Init() {
+	if cfg.MaxParts < 0 || cfg.MaxFileBytes < 0 || cfg.MaxFieldsBytes < 0 || cfg.MaxPartHeaderBytes < 0 {
+		panic(fmt.Errorf("body-limit middleware requires non-negative multipart limits"))
+	}
+}
+
+// boundary returns the multipart boundary of the request or an empty string for non-multipart requests.
+func (cfg *MultipartConfig) boundary(header http.Header) string {
+	mediaType, params, err := mime.ParseMediaType(header.Get(wool.HeaderContentType))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// multipartReader inspects the multipart body while the handler reads it.
+// Every chunk read by the handler is handed to a parser running in a separate goroutine,
+// the read returns once the parser has processed the chunk, failing when any limit is exceeded.
+type multipartReader struct {
+	reader io.ReadCloser
+	cfg    *MultipartConfig
+	header http.Header
+	chunks chan []byte
+	acks   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	// err, limit and observed describe the violated limit, they are written by the parser before done is closed.
+	err      error
+	limit    int64
+	observed int64
+}
+
+func newMultipartReader(reader io.ReadCloser, boundary string, cfg *MultipartConfig, header http.Header) *multipartReader {
+	r := &multipartReader{
+		reader: reader,
+		cfg:    cfg,
+		header: header,
+		chunks: make(chan []byte),
+		acks:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go r.inspect(&chunkReader{r: r}, boundary)
+	return r
+}
+
+func (r *multipartReader) Read(b []byte) (int, error) {
+	if err := r.failure(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(b)
+	if n > 0 {
+		select {
+		case r.chunks <- b[:n]:
+			select {
+			case <-r.acks:
+			case <-r.done:
+			}
+		case <-r.done:
+		}
+	}
+	if err == io.EOF {
+		// wait for the parser to inspect the last part
+		r.finish()
+		<-r.done
+	}
+	if e := r.failure(); e != nil {
+		// withhold the chunk, otherwise the handler could complete parsing without seeing the error
+		return 0, e
+	}
+	return n, err
+}
+
+func (r *multipartReader) Close() error {
+	r.finish()
+	return r.reader.Close()
+}
+
+func (r *multipartReader) finish() {
+	r.once.Do(func() {
+		close(r.chunks)
+	})
+}
+
+// failure returns the error of the parser, err is written by the parser before done is closed.
+func (r *multipartReader) failure() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+func (r *multipartReader) fail(limit, observed int64, message string) {
+	r.limit, r.observed = limit, observed
+	r.err = tooLarge(r.header, message)
+}
+
+func (r *multipartReader) inspect(source io.Reader, boundary string) {
+	defer close(r.done)
+
+	mr := multipart.NewReader(source, boundary)
+	parts := 0
+	var fields int64
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			// malformed bodies are left to the handler
+			return
+		}
+
+		parts++
+		if r.cfg.MaxParts > 0 && parts > r.cfg.MaxParts {
+			r.fail(int64(r.cfg.MaxParts), int64(parts), fmt.Sprintf("multipart body has more than %d parts", r.cfg.MaxParts))
+			return
+		}
+
+		if limit := int64(r.cfg.MaxPartHeaderBytes); limit > 0 {
+			if size := headerSize(part.Header); size > limit {
+				r.fail(limit, size, fmt.Sprintf("multipart part header is larger than %d bytes", limit))
+				return
+			}
+		}
+
+		if part.FileName() != "" {
+			if limit := int64(r.cfg.MaxFileBytes); limit > 0 {
+				if n, _ := io.Copy(io.Discard, io.LimitReader(part, limit+1)); n > limit {
+					r.fail(limit, n, fmt.Sprintf("multipart file %q is larger than %d bytes", part.FileName(), limit))
+					return
+				}
+			}
+		} else if limit := int64(r.cfg.MaxFieldsBytes); limit > 0 {
+			n, _ := io.Copy(io.Discard, io.LimitReader(part, limit-fields+1))
+			if fields += n; fields > limit {
+				r.fail(limit, fields, fmt.Sprintf("multipart fields are larger than %d bytes", limit))
+				return
+			}
+		}
+	}
+}
+
+// chunkReader feeds the parser with the chunks read by the handler.
+// Asking for more data means the parser has processed the previous chunk, which is acknowledged.
+type chunkReader struct {
+	r       *multipartReader
+	chunk   []byte
+	started bool
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	if len(cr.chunk) == 0 {
+		if cr.started {
+			cr.r.acks <- struct{}{}
+		}
+		cr.started = true
+
+		chunk, ok := <-cr.r.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		cr.chunk = chunk
+	}
+
+	n := copy(p, cr.chunk)
+	cr.chunk = cr.chunk[n:]
+	return n, nil
+}
+
+// headerSize returns the size of the header as sent on the wire.
+func headerSize(header map[string][]string) int64 {
+	var size int64
+	for key, values := range header {
+		for _, value := range values {
+			size += int64(len(key) + len(value) + 4)
+		}
+	}
+	return size
+}
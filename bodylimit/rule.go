@@ -0,0 +1,105 @@
+package bodylimit
+
+import (
+	"fmt"
+	"github.com/gowool/wool"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Rule sets the body limit of the matching requests.
+// A request matches when it matches every non-empty list of Paths, Methods and ContentTypes,
+// a list matches when any of its elements matches.
+type Rule struct {
+	// Paths are glob patterns (see path.Match) of request paths,
+	// a pattern ending with "/**" matches the path before it and every path below it.
+	Paths []string `mapstructure:"paths"`
+
+	// Methods are HTTP methods, e.g. "POST".
+	Methods []string `mapstructure:"methods"`
+
+	// ContentTypes are media types of the request body, e.g. "application/json" or "multipart/*".
+	ContentTypes []string `mapstructure:"content_types"`
+
+	// LimitBytes is the maximum allowed size of the request body.
+	LimitBytes Size `mapstructure:"limit_bytes"`
+}
+
+func (r *Rule) init() {
+	if r.LimitBytes < 0 {
+		panic(fmt.Errorf("body-limit middleware rule requires a non-negative limit, got %d", r.LimitBytes))
+	}
+	for _, pattern := range r.Paths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("body-limit middleware rule pattern %q: %w", pattern, err))
+		}
+	}
+	for i, method := range r.Methods {
+		r.Methods[i] = strings.ToUpper(method)
+	}
+	for i, contentType := range r.ContentTypes {
+		r.ContentTypes[i] = strings.ToLower(strings.TrimSpace(contentType))
+	}
+}
+
+func (r *Rule) match(c wool.Ctx) bool {
+	req := c.Req()
+
+	if len(r.Methods) > 0 && !contains(r.Methods, req.Method) {
+		return false
+	}
+
+	if len(r.Paths) > 0 && !matchAny(r.Paths, req.URL.Path, matchPath) {
+		return false
+	}
+
+	if len(r.ContentTypes) > 0 {
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get(wool.HeaderContentType))
+		if err != nil || !matchAny(r.ContentTypes, mediaType, matchMediaType) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchPath reports whether the path matches the glob pattern, a "/**" suffix also matches the subtree.
+func matchPath(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		base := strings.TrimSuffix(pattern, "/**")
+		return p == base || strings.HasPrefix(p, base+"/")
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+func matchMediaType(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+// matchAny reports whether the value matches any of the patterns.
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether the value is one of the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package bodylimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Size is a number of bytes.
+// It can be decoded from a human-readable string like "10MB", "512KiB" or "1.5G".
+type Size int64
+
+var units = map[string]float64{
+	"":    1,
+	"B":   1,
+	"K":   1e3,
+	"KB":  1e3,
+	"KIB": 1 << 10,
+	"M":   1e6,
+	"MB":  1e6,
+	"MIB": 1 << 20,
+	"G":   1e9,
+	"GB":  1e9,
+	"GIB": 1 << 30,
+	"T":   1e12,
+	"TB":  1e12,
+	"TIB": 1 << 40,
+	"P":   1e15,
+	"PB":  1e15,
+	"PIB": 1 << 50,
+}
+
+// ParseSize parses a size string, a decimal number followed by an optional unit.
+// SI units (K, KB, M, MB, G, GB, T, TB, P, PB) are powers of 1000,
+// IEC units (KiB, MiB, GiB, TiB, PiB) are powers of 1024. Units are case-insensitive.
+func ParseSize(s string) (Size, error) {
+	str := strings.TrimSpace(s)
+
+	i := 0
+	for i < len(str) && (str[i] >= '0' && str[i] <= '9' || str[i] == '.') {
+		i++
+	}
+
+	value, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit, ok := units[strings.ToUpper(strings.TrimSpace(str[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, strings.TrimSpace(str[i:]))
+	}
+
+	size := math.Round(value * unit)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: out of range", s)
+	}
+	return Size(size), nil
+}
+
+// UnmarshalJSON decodes the size from a JSON number of bytes or a size string.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var str string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+	} else {
+		str = string(data)
+	}
+
+	size, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
+
+// SizeDecodeHook returns a mapstructure decode hook which decodes strings into Size.
+func SizeDecodeHook() mapstructure.DecodeHookFuncType {
+	sizeType := reflect.TypeOf(Size(0))
+
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if t != sizeType || f.Kind() != reflect.String {
+			return data, nil
+		}
+		return ParseSize(reflect.ValueOf(data).String())
+	}
+}
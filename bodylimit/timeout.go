@@ -0,0 +1,101 @@
+package bodylimit
+
+import (
+	"errors"
+	"github.com/gowool/wool"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// timeoutReader fails the body reads with 408 Request Timeout when the whole body is not read
+// before the deadline or when the client sends it slower than the minimum rate.
+// Before every read it sets the read deadline of the connection, so a stalled client doesn't block
+// the handler. When the response doesn't support deadlines, the limits are checked after every read.
+type timeoutReader struct {
+	reader   io.ReadCloser
+	header   http.Header
+	rc       *http.ResponseController
+	deadline time.Time
+	minRate  int64
+	grace    time.Duration
+	read     int64
+	blocked  time.Duration
+	err      error
+}
+
+func newTimeoutReader(reader io.ReadCloser, res wool.Response, cfg *Config) *timeoutReader {
+	r := &timeoutReader{
+		reader:  reader,
+		header:  res.Header(),
+		rc:      http.NewResponseController(res),
+		minRate: int64(cfg.MinBytesPerSecond),
+		grace:   cfg.MinRateGracePeriod,
+	}
+	if cfg.ReadTimeout > 0 {
+		r.deadline = time.Now().Add(cfg.ReadTimeout)
+	}
+	return r
+}
+
+func (r *timeoutReader) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	start := time.Now()
+	wait := r.wait(start)
+	if wait <= 0 {
+		return 0, r.timeout()
+	}
+
+	if r.rc != nil {
+		if err := r.rc.SetReadDeadline(start.Add(wait)); err != nil {
+			// http.ErrNotSupported, the response doesn't unwrap to the one of the server
+			r.rc = nil
+		}
+	}
+
+	n, err := r.reader.Read(b)
+	elapsed := time.Since(start)
+	r.blocked += elapsed
+	r.read += int64(n)
+
+	if errors.Is(err, os.ErrDeadlineExceeded) || (r.rc == nil && elapsed > wait) {
+		return 0, r.timeout()
+	}
+	if err == io.EOF && r.rc != nil {
+		// the server reads the connection in the background once the body is read
+		_ = r.rc.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
+
+// wait returns how long the next read may block.
+func (r *timeoutReader) wait(now time.Time) time.Duration {
+	wait := time.Duration(1<<63 - 1)
+	if !r.deadline.IsZero() {
+		wait = r.deadline.Sub(now)
+	}
+	if r.minRate > 0 {
+		allowed := r.grace + time.Duration(float64(r.read)/float64(r.minRate)*float64(time.Second)) - r.blocked
+		if allowed < wait {
+			wait = allowed
+		}
+	}
+	return wait
+}
+
+func (r *timeoutReader) timeout() error {
+	r.header.Set(wool.HeaderConnection, "close")
+	r.err = wool.NewError(http.StatusRequestTimeout, nil)
+	return r.err
+}
+
+func (r *timeoutReader) Close() error {
+	return r.reader.Close()
+}
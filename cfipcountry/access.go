@@ -0,0 +1,305 @@
+package cfipcountry
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dlclark/regexp2"
+	"github.com/gowool/wool"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// AccessRule restricts the countries allowed to access the URLs matching the pattern.
+type AccessRule struct {
+	// Pattern is a regular expression matched against the URL path.
+	// Required.
+	Pattern string `mapstructure:"pattern"`
+
+	// Allow is a list of ISO 3166-1 alpha-2 country codes allowed to access the matching URLs,
+	// an empty list allows all countries not listed in Deny.
+	// Optional.
+	Allow []string `mapstructure:"allow"`
+
+	// Deny is a list of ISO 3166-1 alpha-2 country codes denied to access the matching URLs.
+	// Optional.
+	Deny []string `mapstructure:"deny"`
+
+	compiled *regexp2.Regexp
+}
+
+func (r *AccessRule) init() {
+	if r.Pattern == "" {
+		panic("pattern is empty")
+	}
+	re, err := regexp2.Compile(r.Pattern, regexp2.IgnoreCase|regexp2.RE2)
+	if err != nil {
+		panic(err)
+	}
+	r.compiled = re
+	r.Allow = countryCodes(r.Allow)
+	r.Deny = countryCodes(r.Deny)
+}
+
+func (r *AccessRule) match(c wool.Ctx) bool {
+	ok, _ := r.compiled.MatchString(c.Req().URL.Path)
+	return ok
+}
+
+// BlockResponse is sent to the clients denied by the country.
+type BlockResponse struct {
+	// Status of the response.
+	// Optional. Default value 403.
+	Status int `mapstructure:"status"`
+
+	// Body is a template of the response body executed with BlockData.
+	// It is parsed with html/template when the Content-Type of Headers is HTML, otherwise with text/template.
+	// Optional. Default value "Forbidden".
+	Body string `mapstructure:"body"`
+
+	// Headers are added to the response.
+	// Optional. Default Content-Type is "text/plain; charset=utf-8".
+	Headers map[string]string `mapstructure:"headers"`
+
+	tmpl interface {
+		Execute(w io.Writer, data any) error
+	}
+}
+
+// BlockData is passed to the template of the BlockResponse body.
+type BlockData struct {
+	Country string
+	IP      string
+	Path    string
+}
+
+func (r *BlockResponse) init() {
+	if r.Status == 0 {
+		r.Status = http.StatusForbidden
+	}
+	if r.Body == "" {
+		r.Body = http.StatusText(http.StatusForbidden)
+	}
+	if r.isHTML() {
+		r.tmpl = htmltemplate.Must(htmltemplate.New("block").Parse(r.Body))
+	} else {
+		r.tmpl = template.Must(template.New("block").Parse(r.Body))
+	}
+}
+
+// isHTML reports whether the Content-Type of Headers is an HTML media type.
+func (r *BlockResponse) isHTML() bool {
+	for key, value := range r.Headers {
+		if http.CanonicalHeaderKey(key) != wool.HeaderContentType {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(value)
+		return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+	}
+	return false
+}
+
+type AccessConfig struct {
+	// Allow is a list of ISO 3166-1 alpha-2 country codes allowed to access URLs matching no rule,
+	// an empty list allows all countries not listed in Deny.
+	// Requests of unknown country are denied when the list is not empty.
+	// Optional.
+	Allow []string `mapstructure:"allow"`
+
+	// Deny is a list of ISO 3166-1 alpha-2 country codes denied to access URLs matching no rule.
+	// Optional.
+	Deny []string `mapstructure:"deny"`
+
+	// Rules set the allowed countries per URL, the first matching rule wins.
+	// Optional.
+	Rules []*AccessRule `mapstructure:"rules"`
+
+	// TrustedIPs is a list of IP addresses or CIDR ranges of clients which are never blocked.
+	// The client address is taken from Verified,
+	// from the CF-Connecting-IP header for requests coming from CloudflareIPs,
+	// and from the remote address of the request otherwise.
+	// Optional.
+	TrustedIPs []string `mapstructure:"trusted_ips"`
+
+	// CloudflareOnly enables honouring the CF-IPCountry header only for requests coming from CloudflareIPs
+	// or reported by Verified, the header of other requests is removed.
+	// Optional.
+	CloudflareOnly bool `mapstructure:"cloudflare_only"`
+
+	// CloudflareIPs is a list of IP addresses or CIDR ranges of Cloudflare,
+	// used by CloudflareOnly and to resolve the client address.
+	// Optional. Default value CloudflareIPs().
+	CloudflareIPs []string `mapstructure:"cloudflare_ips"`
+
+	// Verified reports the requests verified to come from Cloudflare by a middleware running before,
+	// e.g. the cloudflare middleware with RewriteRemoteAddr enabled.
+	// Optional.
+	Verified VerifiedFunc
+
+	// Resolver resolves the country of the client.
+	// Optional. Default value HeaderResolver.
+	Resolver Resolver
+
+	// Block is the response sent to the denied clients.
+	// Optional.
+	Block BlockResponse `mapstructure:"block"`
+
+	trusted    networks
+	cloudflare networks
+}
+
+func (cfg *AccessConfig) Init() {
+	if cfg.Resolver == nil {
+		cfg.Resolver = HeaderResolver{}
+	}
+	cfg.Allow = countryCodes(cfg.Allow)
+	cfg.Deny = countryCodes(cfg.Deny)
+	for _, rule := range cfg.Rules {
+		rule.init()
+	}
+	cfg.trusted = parseNetworks(cfg.TrustedIPs)
+	if len(cfg.CloudflareIPs) == 0 {
+		cfg.CloudflareIPs = CloudflareIPs()
+	}
+	cfg.cloudflare = parseNetworks(cfg.CloudflareIPs)
+	cfg.Block.init()
+}
+
+// lists returns the allowed and denied countries of the request.
+func (cfg *AccessConfig) lists(c wool.Ctx) ([]string, []string) {
+	for _, rule := range cfg.Rules {
+		if rule.match(c) {
+			return rule.Allow, rule.Deny
+		}
+	}
+	return cfg.Allow, cfg.Deny
+}
+
+// Access allows or denies requests by the country of the client.
+type Access struct {
+	cfg *AccessConfig
+}
+
+func AccessMiddleware(cfg *AccessConfig) wool.Middleware {
+	return NewAccess(cfg).Middleware
+}
+
+func NewAccess(cfg *AccessConfig) *Access {
+	cfg.Init()
+
+	return &Access{cfg: cfg}
+}
+
+func (m *Access) Middleware(next wool.Handler) wool.Handler {
+	return func(c wool.Ctx) error {
+		if m.cfg.CloudflareOnly {
+			stripSpoofed(c, m.cfg.cloudflare, m.cfg.Verified)
+		}
+
+		country, err := resolve(c, m.cfg.Resolver)
+		if err != nil {
+			return err
+		}
+
+		ip := clientIP(c, m.cfg.cloudflare, m.cfg.Verified)
+		if ip != nil && m.cfg.trusted.contains(ip) {
+			return next(c)
+		}
+
+		allow, deny := m.cfg.lists(c)
+		if contains(deny, country) || (len(allow) > 0 && !contains(allow, country)) {
+			return m.block(c, country, ip)
+		}
+
+		return next(c)
+	}
+}
+
+func (m *Access) block(c wool.Ctx, country string, ip net.IP) error {
+	data := BlockData{Country: country, Path: c.Req().URL.Path}
+	if ip != nil {
+		data.IP = ip.String()
+	}
+
+	var body bytes.Buffer
+	if err := m.cfg.Block.tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+
+	header := c.Res().Header()
+	header.Set(wool.HeaderContentType, wool.MIMETextPlainCharsetUTF8)
+	for key, value := range m.cfg.Block.Headers {
+		header.Set(key, value)
+	}
+	return c.Blob(m.cfg.Block.Status, header.Get(wool.HeaderContentType), body.Bytes())
+}
+
+// countryCode normalizes the country code.
+func countryCode(value string) string {
+	return strings.ToUpper(strings.TrimSpace(value))
+}
+
+func countryCodes(codes []string) []string {
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		code = countryCode(code)
+		if len(code) != 2 {
+			panic(fmt.Errorf("invalid country code %q", code))
+		}
+		normalized = append(normalized, code)
+	}
+	return normalized
+}
+
+func parseNetworks(values []string) networks {
+	nets, err := networksOf(values)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+func networksOf(values []string) (networks, error) {
+	nets := make(networks, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
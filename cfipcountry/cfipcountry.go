@@ -4,17 +4,52 @@ import (
 	"github.com/dlclark/regexp2"
 	"github.com/gowool/wool"
 	"net/http"
+	"strings"
 )
 
 const HeaderCfIPCountry = "CF-IPCountry"
 
 type Item struct {
-	Pattern     string `mapstructure:"pattern"`
+	Pattern string `mapstructure:"pattern"`
+
+	// RedirectURL is a template of the redirect location, the placeholders are replaced with:
+	// {country} - the country code, e.g. "DE"
+	// {locale} - the Locale, e.g. "de-de"
+	// {path} - the escaped path of the request, e.g. "/news"
+	// {query} - the query of the request prefixed with "?", or an empty string
+	// E.g. "/{locale}{path}{query}".
 	RedirectURL string `mapstructure:"redirect_url"`
-	Permanently bool   `mapstructure:"permanently"`
+
+	// Locale of the country used in the RedirectURL, it overrides the locale set by WithLocales.
+	// Optional. Default value is the locale of the country set by WithLocales or the lower-cased country code.
+	Locale string `mapstructure:"locale"`
+
+	Permanently bool `mapstructure:"permanently"`
 	compiled    *regexp2.Regexp
 }
 
+// location returns the redirect location for the request from the country.
+func (item *Item) location(c wool.Ctx, country string, locales map[string]string) string {
+	locale := item.Locale
+	if locale == "" {
+		locale = locales[country]
+	}
+	if locale == "" {
+		locale = strings.ToLower(country)
+	}
+	var query string
+	if c.Req().URL.RawQuery != "" {
+		query = "?" + c.Req().URL.RawQuery
+	}
+
+	return strings.NewReplacer(
+		"{country}", country,
+		"{locale}", locale,
+		"{path}", c.Req().URL.EscapedPath(),
+		"{query}", query,
+	).Replace(item.RedirectURL)
+}
+
 type Config map[string]*Item
 
 func (cfg *Config) init() {
@@ -33,47 +68,131 @@ func (cfg *Config) init() {
 	}
 }
 
+type Option func(*CfIPCountry)
+
+// WithResolver sets the resolver of the client country.
+// By default, the country is taken from the CF-IPCountry header.
+func WithResolver(resolver Resolver) Option {
+	return func(m *CfIPCountry) {
+		m.resolver = resolver
+	}
+}
+
+// WithCookie sets the name of the cookie overriding the country of the client,
+// so a user who picked another region is redirected by the item of that region.
+func WithCookie(name string) Option {
+	return func(m *CfIPCountry) {
+		m.cookie = name
+	}
+}
+
+// WithLocales sets the locales of the countries used in the RedirectURL, keyed by country code,
+// e.g. {"AT": "de-at", "CH": "de-ch"}, so an item like "*" can redirect each country to its own locale.
+func WithLocales(locales map[string]string) Option {
+	return func(m *CfIPCountry) {
+		m.locales = make(map[string]string, len(locales))
+		for country, locale := range locales {
+			m.locales[countryCode(country)] = locale
+		}
+	}
+}
+
+// WithCloudflareOnly enables honouring the CF-IPCountry header only for requests coming from Cloudflare
+// or reported by WithVerified, the header of other requests is removed.
+// The ranges default to CloudflareIPs().
+func WithCloudflareOnly(ranges ...string) Option {
+	return func(m *CfIPCountry) {
+		if len(ranges) == 0 {
+			ranges = CloudflareIPs()
+		}
+		m.cloudflare = parseNetworks(ranges)
+	}
+}
+
+// WithVerified sets the function reporting the requests verified to come from Cloudflare
+// by a middleware running before, their CF-IPCountry header is honoured by WithCloudflareOnly.
+func WithVerified(verified VerifiedFunc) Option {
+	return func(m *CfIPCountry) {
+		m.verified = verified
+	}
+}
+
 type CfIPCountry struct {
-	cfg *Config
+	cfg        *Config
+	resolver   Resolver
+	cookie     string
+	locales    map[string]string
+	cloudflare networks
+	verified   VerifiedFunc
 }
 
-func Middleware(cfg *Config) wool.Middleware {
-	return New(cfg).Middleware
+func Middleware(cfg *Config, opts ...Option) wool.Middleware {
+	return New(cfg, opts...).Middleware
 }
 
-func New(cfg *Config) *CfIPCountry {
+func New(cfg *Config, opts ...Option) *CfIPCountry {
 	if cfg != nil {
 		cfg.init()
 	}
-	return &CfIPCountry{cfg: cfg}
+	m := &CfIPCountry{cfg: cfg, resolver: HeaderResolver{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 func (m *CfIPCountry) Middleware(next wool.Handler) wool.Handler {
-	fn := func(c wool.Ctx, item *Item) error {
+	fn := func(c wool.Ctx, item *Item, country string) error {
 		if ok, _ := item.compiled.MatchString(c.Req().URL.String()); !ok {
 			if item.Permanently {
-				return c.Redirect(http.StatusMovedPermanently, item.RedirectURL)
+				return c.Redirect(http.StatusMovedPermanently, item.location(c, country, m.locales))
 			}
-			return c.Redirect(http.StatusFound, item.RedirectURL)
+			return c.Redirect(http.StatusFound, item.location(c, country, m.locales))
 		}
 		return next(c)
 	}
 
 	return func(c wool.Ctx) error {
-		country := c.Req().Header.Get(HeaderCfIPCountry)
+		if m.cloudflare != nil {
+			stripSpoofed(c, m.cloudflare, m.verified)
+		}
+
+		country, err := resolve(c, m.resolver)
+		if err != nil {
+			return err
+		}
 
 		if m.cfg == nil || len(*m.cfg) == 0 {
 			return next(c)
 		}
 
+		if override := m.override(c); override != "" {
+			country = override
+		}
+
 		if item, ok := (*m.cfg)[country]; ok {
-			return fn(c, item)
+			return fn(c, item, country)
 		}
 
 		if item, ok := (*m.cfg)["*"]; ok {
-			return fn(c, item)
+			return fn(c, item, country)
 		}
 
 		return next(c)
 	}
 }
+
+// override returns the country code chosen by the user in the cookie.
+func (m *CfIPCountry) override(c wool.Ctx) string {
+	if m.cookie == "" {
+		return ""
+	}
+	cookie, err := c.Req().Cookie(m.cookie)
+	if err != nil {
+		return ""
+	}
+	if country := countryCode(cookie.Value); len(country) == 2 {
+		return country
+	}
+	return ""
+}
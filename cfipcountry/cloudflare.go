@@ -0,0 +1,89 @@
+package cfipcountry
+
+import (
+	_ "embed"
+	"github.com/gowool/wool"
+	"net"
+	"strings"
+)
+
+//go:generate sh -c "curl -fsSL https://www.cloudflare.com/ips-v4 > ips-v4.txt"
+//go:generate sh -c "curl -fsSL https://www.cloudflare.com/ips-v6 > ips-v6.txt"
+
+var (
+	//go:embed ips-v4.txt
+	cloudflareIPv4 string
+
+	//go:embed ips-v6.txt
+	cloudflareIPv6 string
+)
+
+// headerCfConnectingIP is the header of the client address set by Cloudflare.
+const headerCfConnectingIP = "CF-Connecting-IP"
+
+// cloudflareNetworks are the parsed CloudflareIPs().
+var cloudflareNetworks = parseNetworks(CloudflareIPs())
+
+// CloudflareIPs returns the published IP ranges of Cloudflare embedded at build time,
+// see https://www.cloudflare.com/ips/.
+func CloudflareIPs() []string {
+	return append(strings.Fields(cloudflareIPv4), strings.Fields(cloudflareIPv6)...)
+}
+
+// VerifiedFunc reports whether a middleware running before verified that the request came from Cloudflare,
+// and returns the address of the client. It lets the headers of the verified requests be honoured
+// after that middleware has rewritten the remote address, e.g. with the cloudflare middleware:
+//
+//	func(c wool.Ctx) (net.IP, bool) {
+//		v, ok := cloudflare.VisitorFromCtx(c)
+//		if !ok {
+//			return nil, false
+//		}
+//		return v.IP, true
+//	}
+type VerifiedFunc func(c wool.Ctx) (net.IP, bool)
+
+type networks []*net.IPNet
+
+func (n networks) contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. It is taken from the verified function,
+// from the CF-Connecting-IP header when the request comes from the proxies,
+// and from the remote address of the request otherwise.
+func clientIP(c wool.Ctx, proxies networks, verified VerifiedFunc) net.IP {
+	if verified != nil {
+		if ip, ok := verified(c); ok && ip != nil {
+			return ip
+		}
+	}
+
+	ip := remoteIP(c.Req().Request)
+	if ip == nil || !proxies.contains(ip) {
+		return ip
+	}
+	if client := net.ParseIP(strings.TrimSpace(c.Req().Header.Get(headerCfConnectingIP))); client != nil {
+		return client
+	}
+	return ip
+}
+
+// stripSpoofed removes the CF-IPCountry header when the request doesn't come from the proxies,
+// so a client connecting to the origin directly can't spoof its country.
+// The header of the requests reported by the verified function is kept, their remote address may be already rewritten.
+func stripSpoofed(c wool.Ctx, proxies networks, verified VerifiedFunc) {
+	if verified != nil {
+		if _, ok := verified(c); ok {
+			return
+		}
+	}
+	if ip := remoteIP(c.Req().Request); ip == nil || !proxies.contains(ip) {
+		c.Req().Header.Del(HeaderCfIPCountry)
+	}
+}
@@ -4,6 +4,8 @@ go 1.20
 
 require github.com/gowool/wool v0.0.0-20230505180316-43a82929e1ef
 
+require github.com/oschwald/maxminddb-golang v1.12.0
+
 require (
 	github.com/dlclark/regexp2 v1.10.0
 	github.com/go-playground/locales v0.14.1 // indirect
@@ -15,6 +17,6 @@ require (
 	golang.org/x/crypto v0.7.0 // indirect
 	golang.org/x/exp v0.0.0-20230425010034-47ecfdc1ba53 // indirect
 	golang.org/x/sync v0.1.0 // indirect
-	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
 )
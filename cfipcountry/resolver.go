@@ -0,0 +1,136 @@
+package cfipcountry
+
+import (
+	"github.com/gowool/wool"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// CountryKey is the key of the resolved country code in the wool.Ctx.
+const CountryKey = "cfipcountry.country"
+
+// Resolver resolves the ISO 3166-1 alpha-2 country code of the client,
+// an empty code means the country is unknown.
+type Resolver interface {
+	Country(c wool.Ctx) (string, error)
+}
+
+// ResolverFunc is an adapter to use ordinary functions as Resolver.
+type ResolverFunc func(c wool.Ctx) (string, error)
+
+func (f ResolverFunc) Country(c wool.Ctx) (string, error) {
+	return f(c)
+}
+
+// HeaderResolver resolves the country from the CF-IPCountry header.
+type HeaderResolver struct{}
+
+func (HeaderResolver) Country(c wool.Ctx) (string, error) {
+	return countryCode(c.Req().Header.Get(HeaderCfIPCountry)), nil
+}
+
+// Chain returns a Resolver which asks the resolvers in order until one knows the country,
+// e.g. Chain(HeaderResolver{}, db) uses the database as a fallback when the header is absent.
+func Chain(resolvers ...Resolver) Resolver {
+	return ResolverFunc(func(c wool.Ctx) (string, error) {
+		for _, resolver := range resolvers {
+			country, err := resolver.Country(c)
+			if err != nil {
+				return "", err
+			}
+			if country != "" {
+				return country, nil
+			}
+		}
+		return "", nil
+	})
+}
+
+// MMDBResolver resolves the country by the client IP from a MaxMind DB file,
+// e.g. GeoLite2-Country, GeoIP2-Country or DB-IP Country Lite.
+// The client address is taken from the CF-Connecting-IP header for requests coming from the proxies,
+// and from the remote address of the request otherwise.
+type MMDBResolver struct {
+	db      *maxminddb.Reader
+	proxies networks
+}
+
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// OpenMMDB opens the MaxMind DB file at path.
+// The proxies are IP addresses or CIDR ranges whose CF-Connecting-IP header is trusted,
+// they should match the CloudflareIPs of the middleware. Default value CloudflareIPs().
+func OpenMMDB(path string, proxies ...string) (*MMDBResolver, error) {
+	nets, err := mmdbProxies(proxies)
+	if err != nil {
+		return nil, err
+	}
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDBResolver{db: db, proxies: nets}, nil
+}
+
+// NewMMDB reads the MaxMind DB from the bytes, see OpenMMDB for the proxies.
+func NewMMDB(b []byte, proxies ...string) (*MMDBResolver, error) {
+	nets, err := mmdbProxies(proxies)
+	if err != nil {
+		return nil, err
+	}
+	db, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDBResolver{db: db, proxies: nets}, nil
+}
+
+func mmdbProxies(proxies []string) (networks, error) {
+	if len(proxies) == 0 {
+		return cloudflareNetworks, nil
+	}
+	return networksOf(proxies)
+}
+
+func (r *MMDBResolver) Country(c wool.Ctx) (string, error) {
+	ip := clientIP(c, r.proxies, nil)
+	if ip == nil {
+		return "", nil
+	}
+
+	var record mmdbRecord
+	if err := r.db.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	if record.Country.ISOCode != "" {
+		return countryCode(record.Country.ISOCode), nil
+	}
+	return countryCode(record.RegisteredCountry.ISOCode), nil
+}
+
+// Close releases the database.
+func (r *MMDBResolver) Close() error {
+	return r.db.Close()
+}
+
+// CountryFromCtx returns the country code resolved by the middleware.
+func CountryFromCtx(c wool.Ctx) string {
+	country, _ := c.Get(CountryKey).(string)
+	return country
+}
+
+// resolve resolves the country of the request and stores it in the wool.Ctx.
+func resolve(c wool.Ctx, resolver Resolver) (string, error) {
+	country, err := resolver.Country(c)
+	if err != nil {
+		return "", err
+	}
+	c.Set(CountryKey, country)
+	return country, nil
+}
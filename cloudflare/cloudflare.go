@@ -0,0 +1,208 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gowool/wool"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Cloudflare request headers, see https://developers.cloudflare.com/fundamentals/reference/http-request-headers/.
+const (
+	HeaderCFConnectingIP = "CF-Connecting-IP"
+	HeaderCFRay          = "CF-Ray"
+	HeaderCFVisitor      = "CF-Visitor"
+	HeaderCFIPCountry    = "CF-IPCountry"
+	HeaderCFIPContinent  = "CF-IPContinent"
+	HeaderCFIPCity       = "CF-IPCity"
+	HeaderCFIPLatitude   = "CF-IPLatitude"
+	HeaderCFIPLongitude  = "CF-IPLongitude"
+	HeaderCFWorker       = "CF-Worker"
+)
+
+// headers are the Cloudflare request headers removed from requests of untrusted proxies.
+var headers = []string{
+	HeaderCFConnectingIP,
+	HeaderCFRay,
+	HeaderCFVisitor,
+	HeaderCFIPCountry,
+	HeaderCFIPContinent,
+	HeaderCFIPCity,
+	HeaderCFIPLatitude,
+	HeaderCFIPLongitude,
+	HeaderCFWorker,
+}
+
+// VisitorKey is the key of the Visitor in the wool.Ctx.
+const VisitorKey = "cloudflare.visitor"
+
+// Visitor holds the metadata Cloudflare adds to the request, the fields of absent headers are empty.
+// The location headers are sent only when enabled in the Cloudflare dashboard.
+type Visitor struct {
+	// IP is the address of the client connecting to Cloudflare.
+	IP net.IP
+
+	// Peer is the address of the trusted proxy the request came from, set by the middleware
+	// before the remote address of the request is rewritten.
+	Peer net.IP
+
+	// Ray is the identifier of the request.
+	Ray string
+
+	// Colo is the IATA code of the Cloudflare data center, taken from the Ray.
+	Colo string
+
+	// Scheme is the scheme of the request from the client to Cloudflare.
+	Scheme string
+
+	// Country is the ISO 3166-1 alpha-2 country code, "XX" for unknown and "T1" for Tor.
+	Country string
+
+	// Continent is the continent code, e.g. "EU".
+	Continent string
+
+	// City is the name of the city.
+	City string
+
+	// Latitude and Longitude of the client, valid when HasLocation is true.
+	Latitude    float64
+	Longitude   float64
+	HasLocation bool
+
+	// Worker is the domain of the Cloudflare Worker which made the subrequest.
+	Worker string
+}
+
+type Config struct {
+	// TrustedProxies is a list of IP addresses or CIDR ranges the Cloudflare headers are accepted from,
+	// the headers are removed from other requests, so the handlers can't be fooled by spoofed values.
+	// Optional. Default value IPs().
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+	// RewriteRemoteAddr sets the remote address of the request to CF-Connecting-IP.
+	// Optional.
+	RewriteRemoteAddr bool `mapstructure:"rewrite_remote_addr"`
+
+	// RewriteScheme sets the scheme of the request URL to the scheme of CF-Visitor.
+	// Optional.
+	RewriteScheme bool `mapstructure:"rewrite_scheme"`
+
+	proxies []*net.IPNet
+}
+
+func (cfg *Config) Init() {
+	if len(cfg.TrustedProxies) == 0 {
+		cfg.TrustedProxies = IPs()
+	}
+	proxies, err := ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		panic(fmt.Errorf("cloudflare middleware trusted proxy: %w", err))
+	}
+	cfg.proxies = proxies
+}
+
+// trustedPeer returns the address of the peer when it is one of the trusted proxies.
+func (cfg *Config) trustedPeer(remoteAddr string) (net.IP, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, false
+	}
+	for _, network := range cfg.proxies {
+		if network.Contains(ip) {
+			return ip, true
+		}
+	}
+	return nil, false
+}
+
+type Cloudflare struct {
+	cfg *Config
+}
+
+func Middleware(cfg *Config) wool.Middleware {
+	return New(cfg).Middleware
+}
+
+func New(cfg *Config) *Cloudflare {
+	cfg.Init()
+
+	return &Cloudflare{cfg: cfg}
+}
+
+func (m *Cloudflare) Middleware(next wool.Handler) wool.Handler {
+	return func(c wool.Ctx) error {
+		peer, ok := m.cfg.trustedPeer(c.Req().RemoteAddr)
+		if !ok {
+			for _, key := range headers {
+				c.Req().Header.Del(key)
+			}
+			return next(c)
+		}
+
+		visitor := Parse(c.Req().Header)
+		visitor.Peer = peer
+		c.Set(VisitorKey, visitor)
+
+		if m.cfg.RewriteRemoteAddr && visitor.IP != nil {
+			c.Req().RemoteAddr = visitor.IP.String()
+		}
+		if m.cfg.RewriteScheme && visitor.Scheme != "" {
+			c.Req().URL.Scheme = visitor.Scheme
+		}
+
+		return next(c)
+	}
+}
+
+// VisitorFromCtx returns the Visitor parsed by the middleware,
+// it is present only when the request came from a trusted proxy.
+func VisitorFromCtx(c wool.Ctx) (*Visitor, bool) {
+	v, ok := c.Get(VisitorKey).(*Visitor)
+	return v, ok
+}
+
+// Parse reads the Visitor from the Cloudflare headers, malformed values are ignored.
+func Parse(header http.Header) *Visitor {
+	get := func(key string) string {
+		return strings.TrimSpace(header.Get(key))
+	}
+
+	v := &Visitor{
+		IP:        net.ParseIP(get(HeaderCFConnectingIP)),
+		Ray:       get(HeaderCFRay),
+		Country:   strings.ToUpper(get(HeaderCFIPCountry)),
+		Continent: strings.ToUpper(get(HeaderCFIPContinent)),
+		City:      get(HeaderCFIPCity),
+		Worker:    get(HeaderCFWorker),
+	}
+
+	// e.g. "230b030023ae2822-SJC"
+	if idx := strings.LastIndexByte(v.Ray, '-'); idx >= 0 {
+		v.Colo = v.Ray[idx+1:]
+	}
+
+	// e.g. {"scheme":"https"}
+	var visitor struct {
+		Scheme string `json:"scheme"`
+	}
+	if err := json.Unmarshal([]byte(get(HeaderCFVisitor)), &visitor); err == nil {
+		if scheme := strings.ToLower(visitor.Scheme); scheme == "http" || scheme == "https" {
+			v.Scheme = scheme
+		}
+	}
+
+	lat, errLat := strconv.ParseFloat(get(HeaderCFIPLatitude), 64)
+	lon, errLon := strconv.ParseFloat(get(HeaderCFIPLongitude), 64)
+	if errLat == nil && errLon == nil && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 {
+		v.Latitude, v.Longitude, v.HasLocation = lat, lon, true
+	}
+
+	return v
+}
@@ -0,0 +1,19 @@
+module github.com/gowool/middleware/cloudflare
+
+go 1.19
+
+require github.com/gowool/wool v0.0.0-20230505180316-43a82929e1ef
+
+require (
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.12.0 // indirect
+	github.com/goccy/go-json v0.10.2 // indirect
+	github.com/leodido/go-urn v1.2.2 // indirect
+	github.com/spf13/cast v1.5.0 // indirect
+	golang.org/x/crypto v0.7.0 // indirect
+	golang.org/x/exp v0.0.0-20230425010034-47ecfdc1ba53 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/text v0.8.0 // indirect
+)
@@ -0,0 +1,50 @@
+package cloudflare
+
+import (
+	_ "embed"
+	"fmt"
+	"net"
+	"strings"
+)
+
+//go:generate sh -c "curl -fsSL https://www.cloudflare.com/ips-v4 > ips-v4.txt"
+//go:generate sh -c "curl -fsSL https://www.cloudflare.com/ips-v6 > ips-v6.txt"
+
+var (
+	//go:embed ips-v4.txt
+	ipv4 string
+
+	//go:embed ips-v6.txt
+	ipv6 string
+)
+
+// IPs returns the published IP ranges of Cloudflare embedded at build time,
+// see https://www.cloudflare.com/ips/.
+func IPs() []string {
+	return append(strings.Fields(ipv4), strings.Fields(ipv6)...)
+}
+
+// ParseNetworks parses a list of IP addresses or CIDR ranges, an address is a network of the single address.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -1,15 +1,19 @@
 package cors
 
 import (
+	"errors"
 	"github.com/gowool/wool"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
-var (
-	allowCredentials = true
+const (
+	HeaderAccessControlRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	HeaderAccessControlAllowPrivateNetwork   = "Access-Control-Allow-Private-Network"
+)
 
+var (
 	DefaultConfig = &Config{
 		AllowedOrigin: "*",
 		AllowedHeaders: strings.Join([]string{
@@ -18,8 +22,7 @@ var (
 			wool.HeaderAuthorization,
 			wool.HeaderLastEventID,
 		}, ","),
-		AllowedMethods:   strings.Join(wool.DefaultMethods, ","),
-		AllowCredentials: &allowCredentials,
+		AllowedMethods: strings.Join(wool.DefaultMethods, ","),
 		ExposedHeaders: strings.Join([]string{
 			wool.HeaderContentType,
 			wool.HeaderContentLanguage,
@@ -35,15 +38,40 @@ var (
 
 type Config struct {
 	// AllowedOrigin: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Allow-Origin
+	// It is added to AllowedOrigins, "*" allows any origin.
 	AllowedOrigin string `mapstructure:"allowed_origin"`
 
+	// AllowedOrigins is a list of origins a cross-domain request can be executed from,
+	// the matching request origin is reflected in the response. An origin can be:
+	// - exact, e.g. "https://example.com"
+	// - a wildcard subdomain, e.g. "https://*.example.com"
+	// - a regular expression starting with "^", e.g. "^https://(www|api)\.example\.com$",
+	//   matched against the whole origin ignoring case
+	// - "*" to allow any origin
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// AllowOriginFunc is a function to validate the request origin, it is called when the origin matches
+	// none of AllowedOrigins.
+	AllowOriginFunc func(c wool.Ctx, origin string) bool
+
+	// ReflectOrigin responds with the request origin instead of "*" when any origin is allowed,
+	// which is required to allow any origin with credentials.
+	// Optional.
+	ReflectOrigin bool `mapstructure:"reflect_origin"`
+
 	// AllowedHeaders: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Allow-Headers
+	// A comma separated list of headers, "*" allows any header.
+	// Preflight requests asking for other headers are not allowed.
 	AllowedHeaders string `mapstructure:"allowed_headers"`
 
 	// AllowedMethods: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Allow-Methods
+	// A comma separated list of methods, "*" allows any method.
+	// Preflight requests asking for other methods are not allowed.
+	// Optional. Default value "GET,HEAD,POST".
 	AllowedMethods string `mapstructure:"allowed_methods"`
 
 	// AllowCredentials https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Allow-Credentials
+	// It can't be combined with "*" origin unless ReflectOrigin is set.
 	AllowCredentials *bool `mapstructure:"allow_credentials"`
 
 	// ExposeHeaders:  https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Expose-Headers
@@ -51,6 +79,122 @@ type Config struct {
 
 	// MaxAge of CORS headers in seconds/
 	MaxAge int `mapstructure:"max_age"`
+
+	// AllowPrivateNetwork allows requests from public websites to the private network,
+	// see https://wicg.github.io/private-network-access/.
+	// Optional.
+	AllowPrivateNetwork bool `mapstructure:"allow_private_network"`
+
+	// PreflightStatus is the status of the response to preflight requests, e.g. 204.
+	// Optional. Default value 200.
+	PreflightStatus int `mapstructure:"preflight_status"`
+
+	// OptionsPassthrough passes preflight requests to the next handler after setting the CORS headers,
+	// instead of responding with PreflightStatus.
+	// Optional.
+	OptionsPassthrough bool `mapstructure:"options_passthrough"`
+
+	// Policies apply different configurations by path and method, the first matching policy wins.
+	// Requests matching no policy are handled by this Config.
+	// Optional.
+	Policies []*Policy `mapstructure:"policies"`
+
+	allowAll bool
+	origins  []originMatcher
+	methods  []string
+	headers  []string
+}
+
+func (cfg *Config) Init() {
+	if cfg.PreflightStatus == 0 {
+		cfg.PreflightStatus = http.StatusOK
+	}
+
+	cfg.allowAll = false
+	cfg.origins = nil
+
+	origins := cfg.AllowedOrigins
+	if cfg.AllowedOrigin != "" {
+		origins = append([]string{cfg.AllowedOrigin}, origins...)
+	}
+	for _, origin := range origins {
+		if origin == "*" {
+			cfg.allowAll = true
+			continue
+		}
+		cfg.origins = append(cfg.origins, newOriginMatcher(origin))
+	}
+
+	if cfg.allowAll && cfg.AllowCredentials != nil && *cfg.AllowCredentials && !cfg.ReflectOrigin {
+		panic(errors.New("cors middleware can't allow credentials for any origin \"*\", set reflect origin or list the allowed origins"))
+	}
+
+	if cfg.AllowedMethods == "" {
+		cfg.AllowedMethods = strings.Join([]string{http.MethodGet, http.MethodHead, http.MethodPost}, ",")
+	}
+	cfg.methods = splitList(strings.ToUpper(cfg.AllowedMethods))
+	cfg.headers = splitList(strings.ToLower(cfg.AllowedHeaders))
+
+	for _, policy := range cfg.Policies {
+		policy.init()
+	}
+}
+
+// policy returns the configuration of the request.
+func (cfg *Config) policy(c wool.Ctx, preflight bool) *Config {
+	for _, policy := range cfg.Policies {
+		if policy.match(c, preflight) {
+			return &policy.Config
+		}
+	}
+	return cfg
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for the request origin,
+// an empty string means the origin is not allowed.
+func (cfg *Config) allowOrigin(c wool.Ctx, origin string) string {
+	if cfg.allowAll {
+		if cfg.ReflectOrigin {
+			return origin
+		}
+		return "*"
+	}
+	for _, m := range cfg.origins {
+		if m.match(origin) {
+			return origin
+		}
+	}
+	if cfg.AllowOriginFunc != nil && cfg.AllowOriginFunc(c, origin) {
+		return origin
+	}
+	return ""
+}
+
+// preflight returns the method and headers requested by the preflight request,
+// ok is false when any of them is not allowed.
+func (cfg *Config) preflight(header http.Header) (method string, headers []string, ok bool) {
+	method = header.Get(wool.HeaderAccessControlRequestMethod)
+	if !contains(cfg.methods, "*") && !contains(cfg.methods, strings.ToUpper(method)) {
+		return "", nil, false
+	}
+
+	for _, value := range header.Values(wool.HeaderAccessControlRequestHeaders) {
+		for _, h := range splitList(strings.ToLower(value)) {
+			if !contains(cfg.headers, "*") && !contains(cfg.headers, h) {
+				return "", nil, false
+			}
+			headers = append(headers, h)
+		}
+	}
+	return method, headers, true
+}
+
+func (cfg *Config) setOrigin(headers http.Header, allowOrigin string) {
+	headers.Set(wool.HeaderAccessControlAllowOrigin, allowOrigin)
+
+	if cfg.AllowCredentials != nil {
+		headers.Set(wool.HeaderAccessControlAllowCredentials, strconv.FormatBool(*cfg.AllowCredentials))
+	}
 }
 
 type CORS struct {
@@ -62,46 +206,96 @@ func Middleware(cfg *Config) wool.Middleware {
 }
 
 func New(cfg *Config) *CORS {
+	cfg.Init()
+
 	return &CORS{cfg: cfg}
 }
 
 func (m *CORS) Middleware(next wool.Handler) wool.Handler {
 	return func(c wool.Ctx) error {
 		headers := c.Res().Header()
+		preflight := isPreflight(c.Req().Request)
+		cfg := m.cfg.policy(c, preflight)
 
 		headers.Add(wool.HeaderVary, "Origin")
-
-		if m.cfg.AllowedOrigin != "" {
-			headers.Set(wool.HeaderAccessControlAllowOrigin, m.cfg.AllowedOrigin)
+		if preflight {
+			headers.Add(wool.HeaderVary, "Access-Control-Request-Method")
+			headers.Add(wool.HeaderVary, "Access-Control-Request-Headers")
+			if cfg.AllowPrivateNetwork {
+				headers.Add(wool.HeaderVary, HeaderAccessControlRequestPrivateNetwork)
+			}
 		}
 
-		if m.cfg.AllowedHeaders != "" {
-			headers.Set(wool.HeaderAccessControlAllowHeaders, m.cfg.AllowedHeaders)
+		var allowOrigin string
+		if origin := c.Req().Header.Get(wool.HeaderOrigin); origin != "" {
+			allowOrigin = cfg.allowOrigin(c, origin)
 		}
 
-		if m.cfg.AllowCredentials != nil {
-			headers.Set(wool.HeaderAccessControlAllowCredentials, strconv.FormatBool(*m.cfg.AllowCredentials))
+		if !preflight {
+			if allowOrigin != "" {
+				cfg.setOrigin(headers, allowOrigin)
+
+				if cfg.ExposedHeaders != "" {
+					headers.Set(wool.HeaderAccessControlExposeHeaders, cfg.ExposedHeaders)
+				}
+			}
+
+			return next(c)
 		}
 
-		if c.Req().Method == http.MethodOptions {
-			headers.Add(wool.HeaderVary, "Access-Control-Request-Method")
-			headers.Add(wool.HeaderVary, "Access-Control-Request-Headers")
+		// a preflight asking for anything not allowed is answered without CORS headers, so the browser blocks the request
+		if allowOrigin != "" {
+			if method, requestHeaders, ok := cfg.preflight(c.Req().Header); ok {
+				cfg.setOrigin(headers, allowOrigin)
 
-			if m.cfg.AllowedMethods != "" {
-				headers.Set(wool.HeaderAccessControlAllowMethods, m.cfg.AllowedMethods)
-			}
+				headers.Set(wool.HeaderAccessControlAllowMethods, method)
+
+				if len(requestHeaders) > 0 {
+					headers.Set(wool.HeaderAccessControlAllowHeaders, strings.Join(requestHeaders, ","))
+				}
+
+				if cfg.MaxAge > 0 {
+					headers.Set(wool.HeaderAccessControlMaxAge, strconv.Itoa(cfg.MaxAge))
+				}
 
-			if m.cfg.MaxAge > 0 {
-				headers.Set(wool.HeaderAccessControlMaxAge, strconv.Itoa(m.cfg.MaxAge))
+				if cfg.AllowPrivateNetwork && c.Req().Header.Get(HeaderAccessControlRequestPrivateNetwork) == "true" {
+					headers.Set(HeaderAccessControlAllowPrivateNetwork, "true")
+				}
 			}
+		}
 
-			return c.OK()
+		if cfg.OptionsPassthrough {
+			return next(c)
 		}
+		return c.Status(cfg.PreflightStatus)
+	}
+}
+
+// isPreflight reports whether the request is a CORS-preflight request, see https://fetch.spec.whatwg.org/#cors-preflight-request.
+// Other OPTIONS requests are handled as actual requests.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get(wool.HeaderOrigin) != "" &&
+		r.Header.Get(wool.HeaderAccessControlRequestMethod) != ""
+}
 
-		if m.cfg.ExposedHeaders != "" {
-			headers.Set(wool.HeaderAccessControlExposeHeaders, m.cfg.ExposedHeaders)
+// splitList splits a comma separated list, omitting empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
 		}
+	}
+	return list
+}
 
-		return next(c)
+// contains reports whether the value is one of the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
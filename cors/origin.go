@@ -0,0 +1,70 @@
+package cors
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// originMatcher matches the request origin against an allowed origin pattern.
+type originMatcher struct {
+	exact  string
+	prefix string
+	suffix string
+	re     *regexp.Regexp
+}
+
+// newOriginMatcher compiles the allowed origin pattern:
+// - "https://example.com" matches the origin exactly, ignoring case
+// - "https://*.example.com" matches any subdomain of example.com, but not example.com itself
+// - "^https://(www|api)\.example\.com$" is a regular expression, as it starts with "^",
+// it is matched against the whole origin ignoring case, even without the trailing "$"
+func newOriginMatcher(pattern string) originMatcher {
+	if strings.HasPrefix(pattern, "^") {
+		re, err := regexp.Compile(`(?i)^(?:` + trimAnchors(pattern) + `)$`)
+		if err != nil {
+			panic(fmt.Errorf("cors middleware allowed origin %q: %w", pattern, err))
+		}
+		return originMatcher{re: re}
+	}
+
+	pattern = strings.ToLower(pattern)
+	if prefix, suffix, ok := strings.Cut(pattern, "*"); ok {
+		if strings.Contains(suffix, "*") {
+			panic(fmt.Errorf("cors middleware allowed origin %q has more than one wildcard", pattern))
+		}
+		return originMatcher{prefix: prefix, suffix: suffix}
+	}
+	return originMatcher{exact: pattern}
+}
+
+func (m originMatcher) match(origin string) bool {
+	if m.re != nil {
+		return m.re.MatchString(origin)
+	}
+
+	origin = strings.ToLower(origin)
+	if m.exact != "" {
+		return origin == m.exact
+	}
+	if len(origin) <= len(m.prefix)+len(m.suffix) || !strings.HasPrefix(origin, m.prefix) || !strings.HasSuffix(origin, m.suffix) {
+		return false
+	}
+	wildcard := origin[len(m.prefix) : len(origin)-len(m.suffix)]
+	return !strings.ContainsAny(wildcard, "/:@")
+}
+
+// trimAnchors removes the leading "^" and the trailing "$" of the pattern, unless the "$" is escaped.
+func trimAnchors(pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "^")
+	if strings.HasSuffix(pattern, "$") {
+		backslashes := 0
+		for i := len(pattern) - 2; i >= 0 && pattern[i] == '\\'; i-- {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			pattern = pattern[:len(pattern)-1]
+		}
+	}
+	return pattern
+}
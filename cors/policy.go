@@ -0,0 +1,85 @@
+package cors
+
+import (
+	"fmt"
+	"github.com/gowool/wool"
+	"path"
+	"strings"
+)
+
+// Policy applies its own CORS configuration to the matching requests.
+// A request matches when it matches every non-empty list of Paths and Methods,
+// a list matches when any of its elements matches.
+// Preflight requests are matched by the method they ask for.
+type Policy struct {
+	// Name of the policy, used in error messages.
+	Name string `mapstructure:"name"`
+
+	// Paths are glob patterns (see path.Match) of request paths,
+	// a pattern ending with "/**" matches the path before it and every path below it.
+	Paths []string `mapstructure:"paths"`
+
+	// Methods are HTTP methods, e.g. "GET".
+	Methods []string `mapstructure:"methods"`
+
+	// Config of the policy, its Policies are ignored.
+	Config `mapstructure:",squash"`
+}
+
+func (p *Policy) init() {
+	defer func() {
+		if r := recover(); r != nil {
+			panic(fmt.Errorf("cors middleware policy %q: %v", p.Name, r))
+		}
+	}()
+
+	for _, pattern := range p.Paths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("path pattern %q: %w", pattern, err))
+		}
+	}
+	for i, method := range p.Methods {
+		p.Methods[i] = strings.ToUpper(method)
+	}
+
+	p.Config.Policies = nil
+	p.Config.Init()
+}
+
+func (p *Policy) match(c wool.Ctx, preflight bool) bool {
+	req := c.Req()
+
+	method := req.Method
+	if preflight {
+		method = strings.ToUpper(req.Header.Get(wool.HeaderAccessControlRequestMethod))
+	}
+	if len(p.Methods) > 0 && !contains(p.Methods, method) {
+		return false
+	}
+
+	if len(p.Paths) > 0 && !matchAny(p.Paths, req.URL.Path, matchPath) {
+		return false
+	}
+
+	return true
+}
+
+// matchPath reports whether the path matches the glob pattern, a "/**" suffix also matches the subtree.
+func matchPath(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		base := strings.TrimSuffix(pattern, "/**")
+		return p == base || strings.HasPrefix(p, base+"/")
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// matchAny reports whether the value matches any of the patterns.
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}